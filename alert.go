@@ -0,0 +1,498 @@
+// Package main (alert.go) :
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tanaikech/gonetatmo/netatmo"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	rulesFile       = "gonetatmo.rules.yaml"
+	alertStateFile  = "gonetatmo.alerts.json"
+	notWorkingField = "not_working" // 1 when the module stops reporting, else 0.
+)
+
+// alertRule : Condition over a field of insideData and outsideData.
+type alertRule struct {
+	Name     string   `json:"name" yaml:"name"`
+	Module   string   `json:"module,omitempty" yaml:"module,omitempty"`     // Module name or ID. Empty is all modules.
+	Field    string   `json:"field" yaml:"field"`                           // e.g. "CO2", "battery_percent" and "not_working"
+	Op       string   `json:"op" yaml:"op"`                                 // ">", ">=", "<" or "<="
+	Value    float64  `json:"value" yaml:"value"`                           // Threshold for firing.
+	Clear    *float64 `json:"clear,omitempty" yaml:"clear,omitempty"`       // Threshold for resolving. Default is value.
+	Cooldown string   `json:"cooldown,omitempty" yaml:"cooldown,omitempty"` // Minimum interval between notifications of firing.
+	Sinks    []string `json:"sinks,omitempty" yaml:"sinks,omitempty"`       // Names of sinks. Default is all sinks.
+	cooldown time.Duration
+}
+
+// sinkConfig : Config of sink for notifications.
+type sinkConfig struct {
+	Name     string            `json:"name" yaml:"name"`
+	Type     string            `json:"type" yaml:"type"` // stdout, webhook, email or exec
+	URL      string            `json:"url,omitempty" yaml:"url,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Template string            `json:"template,omitempty" yaml:"template,omitempty"` // Built-in template (json, slack, discord and teams) or text/template.
+	Secret   string            `json:"secret,omitempty" yaml:"secret,omitempty"`
+	Retry    int               `json:"retry,omitempty" yaml:"retry,omitempty"`
+	SMTPHost string            `json:"smtp_host,omitempty" yaml:"smtp_host,omitempty"`
+	SMTPPort int               `json:"smtp_port,omitempty" yaml:"smtp_port,omitempty"`
+	Username string            `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string            `json:"password,omitempty" yaml:"password,omitempty"`
+	From     string            `json:"from,omitempty" yaml:"from,omitempty"`
+	To       []string          `json:"to,omitempty" yaml:"to,omitempty"`
+	Command  string            `json:"command,omitempty" yaml:"command,omitempty"`
+	Args     []string          `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+// alertConfig : Rules file.
+type alertConfig struct {
+	Rules []*alertRule  `json:"rules" yaml:"rules"`
+	Sinks []*sinkConfig `json:"sinks" yaml:"sinks"`
+}
+
+// alertEvent : Notification of firing or resolving.
+type alertEvent struct {
+	Rule      string   `json:"rule"`
+	State     string   `json:"state"` // firing or resolved
+	ModuleID  string   `json:"module_id"`
+	Module    string   `json:"module"`
+	Field     string   `json:"field"`
+	Value     float64  `json:"value"`
+	Threshold float64  `json:"threshold"`
+	Time      int64    `json:"time"`
+	Message   string   `json:"message"`
+	sinks     []string `json:"-"`
+}
+
+// alertTarget : Values of a module for evaluating rules.
+type alertTarget struct {
+	ID      string
+	Name    string
+	TimeUtc int64
+	Values  map[string]float64
+}
+
+// compare : Compare v with threshold by op.
+func compare(op string, v, threshold float64) bool {
+	switch op {
+	case ">":
+		return v > threshold
+	case ">=":
+		return v >= threshold
+	case "<":
+		return v < threshold
+	case "<=":
+		return v <= threshold
+	}
+	return false
+}
+
+// readAlertConfig : Read and check the rules file. The file is YAML or JSON by the extension.
+func readAlertConfig(path string) (*alertConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error: Couldn't read rules file. %v", err))
+	}
+	ac := &alertConfig{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(b, ac)
+	} else {
+		err = yaml.Unmarshal(b, ac)
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error: Wrong rules file '%s'. %v", path, err))
+	}
+	if len(ac.Rules) == 0 {
+		return nil, errors.New(fmt.Sprintf("Error: No rules in '%s'.", path))
+	}
+	if len(ac.Sinks) == 0 {
+		ac.Sinks = []*sinkConfig{{Type: "stdout"}}
+	}
+	names := map[string]bool{}
+	for _, s := range ac.Sinks {
+		if s.Name == "" {
+			s.Name = s.Type
+		}
+		if names[s.Name] {
+			return nil, errors.New(fmt.Sprintf("Error: Sink '%s' is duplicated. Please set 'name'.", s.Name))
+		}
+		names[s.Name] = true
+	}
+	for i, r := range ac.Rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("%s %s %v", r.Field, r.Op, r.Value)
+		}
+		r.Field = strings.ToLower(r.Field)
+		if r.Field == "" {
+			return nil, errors.New(fmt.Sprintf("Error: Rule #%d has no field.", i+1))
+		}
+		if r.Field == notWorkingField && r.Op == "" {
+			r.Op, r.Value = ">=", 1
+		}
+		switch r.Op {
+		case ">", ">=", "<", "<=":
+		default:
+			return nil, errors.New(fmt.Sprintf("Error: Rule '%s' has wrong op '%s'. Please use >, >=, < or <=.", r.Name, r.Op))
+		}
+		if r.Clear != nil && compare(r.Op, *r.Clear, r.Value) && *r.Clear != r.Value {
+			return nil, errors.New(fmt.Sprintf("Error: Rule '%s' has clear %v on the firing side of value %v.", r.Name, *r.Clear, r.Value))
+		}
+		if r.Cooldown != "" {
+			if r.cooldown, err = time.ParseDuration(r.Cooldown); err != nil {
+				return nil, errors.New(fmt.Sprintf("Error: Rule '%s' has wrong cooldown '%s'.", r.Name, r.Cooldown))
+			}
+		}
+		for _, s := range r.Sinks {
+			if !names[s] {
+				return nil, errors.New(fmt.Sprintf("Error: Rule '%s' uses unknown sink '%s'.", r.Name, s))
+			}
+		}
+	}
+	return ac, nil
+}
+
+// fieldValues : Retrieve numeric fields of insideData and outsideData by the lower case of the JSON keys.
+func fieldValues(v interface{}) map[string]float64 {
+	res := map[string]float64{}
+	rv := reflect.ValueOf(v)
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		key := strings.ToLower(strings.Split(rt.Field(i).Tag.Get("json"), ",")[0])
+		f := rv.Field(i)
+		switch f.Kind() {
+		case reflect.Int, reflect.Int64:
+			res[key] = float64(f.Int())
+		case reflect.Float64:
+			res[key] = f.Float()
+		}
+	}
+	return res
+}
+
+// moduleFields : Measured fields of outsideData for each type of module. The other measured fields are not evaluated.
+var moduleFields = map[string][]string{
+	netatmo.TypeOutdoor: {"temperature", "humidity", "min_temp", "max_temp"},
+	netatmo.TypeIndoor:  {"temperature", "humidity", "co2", "min_temp", "max_temp"},
+	netatmo.TypeWind:    {"windstrength", "windangle", "guststrength", "gustangle", "max_wind_str", "max_wind_angle"},
+	netatmo.TypeRain:    {"rain", "sum_rain_1", "sum_rain_24"},
+}
+
+// alertTargets : Retrieve targets from parsed stations data.
+func alertTargets(s *stations) []alertTarget {
+	var res []alertTarget
+	nt := time.Now().Unix()
+	add := func(id, name string, t int64, v interface{}) {
+		values := fieldValues(v)
+		values[notWorkingField] = 0
+		if nt-t > mestimeThreshold {
+			values[notWorkingField] = 1
+		}
+		res = append(res, alertTarget{ID: id, Name: name, TimeUtc: t, Values: values})
+	}
+	for _, st := range s.Stations {
+		stationName := ""
+		for _, f := range st.Inside {
+			stationName = f.StationName
+			add(f.Id, strings.TrimSpace(f.StationName+" "+f.ModuleName), f.TimeUtc, f)
+		}
+		for _, f := range append(append([]outsideData{}, st.IndoorModule...), st.Outside...) {
+			add(f.Id, strings.TrimSpace(stationName+" "+f.ModuleName), f.TimeUtc, f)
+			values := res[len(res)-1].Values
+			for _, fields := range moduleFields {
+				for _, k := range fields {
+					delete(values, k)
+				}
+			}
+			for k, v := range fieldValues(f) {
+				for _, e := range moduleFields[f.Type] {
+					if k == e {
+						values[k] = v
+					}
+				}
+			}
+		}
+	}
+	return res
+}
+
+// alertState : State of a rule for a module. This is saved to the state file, so it is kept between runs of "watch --once".
+type alertState struct {
+	Firing   bool      `json:"firing"`
+	Notified bool      `json:"notified"` // Firing was notified.
+	Last     time.Time `json:"last"`
+}
+
+// alertEvaluator : Evaluator of rules keeping the states for hysteresis and cooldown.
+type alertEvaluator struct {
+	rules  []*alertRule
+	states map[string]*alertState
+}
+
+// evaluate : Evaluate rules and retrieve events to be notified. A rule fires when the value satisfies "op value",
+// and it is resolved when the value doesn't satisfy "op clear".
+func (ae *alertEvaluator) evaluate(targets []alertTarget, now time.Time) []alertEvent {
+	if ae.states == nil {
+		ae.states = map[string]*alertState{}
+	}
+	var events []alertEvent
+	for _, r := range ae.rules {
+		for _, t := range targets {
+			if r.Module != "" && !strings.EqualFold(r.Module, t.ID) && !strings.Contains(strings.ToLower(t.Name), strings.ToLower(r.Module)) {
+				continue
+			}
+			v, ok := t.Values[r.Field]
+			if !ok || (r.Field != notWorkingField && t.TimeUtc == 0) {
+				continue
+			}
+			key := r.Name + "\x00" + t.ID
+			st := ae.states[key]
+			if st == nil {
+				st = &alertState{}
+				ae.states[key] = st
+			}
+			clear := r.Value
+			if r.Clear != nil {
+				clear = *r.Clear
+			}
+			e := alertEvent{
+				Rule:     r.Name,
+				ModuleID: t.ID,
+				Module:   t.Name,
+				Field:    r.Field,
+				Value:    v,
+				Time:     now.Unix(),
+				sinks:    r.Sinks,
+			}
+			switch {
+			case !st.Firing && compare(r.Op, v, r.Value):
+				st.Firing = true
+				st.Notified = false
+			case st.Firing && !compare(r.Op, v, clear):
+				st.Firing = false
+				if st.Notified {
+					e.State, e.Threshold = "resolved", clear
+					e.Message = fmt.Sprintf("[RESOLVED] %s: %s %s is %v", r.Name, t.Name, r.Field, v)
+					events = append(events, e)
+				}
+				st.Notified = false
+				continue
+			}
+			// The firing within the cooldown is kept pending, and it is notified after the cooldown while it is firing.
+			if !st.Firing || st.Notified || (!st.Last.IsZero() && now.Sub(st.Last) < r.cooldown) {
+				continue
+			}
+			st.Notified = true
+			st.Last = now
+			e.State, e.Threshold = "firing", r.Value
+			e.Message = fmt.Sprintf("[FIRING] %s: %s %s is %v (%s %v)", r.Name, t.Name, r.Field, v, r.Op, r.Value)
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// readAlertStates : Read the states saved by the previous run. When the file doesn't exist, the states are empty.
+func readAlertStates(path string) (map[string]*alertState, error) {
+	states := map[string]*alertState{}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return states, nil
+	} else if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error: Couldn't read state file. %v", err))
+	}
+	if err := json.Unmarshal(b, &states); err != nil {
+		return nil, errors.New(fmt.Sprintf("Error: Wrong state file '%s'. %v", path, err))
+	}
+	return states, nil
+}
+
+// saveAlertStates : Save the states for the next run.
+func saveAlertStates(path string, states map[string]*alertState) error {
+	b, err := json.Marshal(states)
+	if err != nil {
+		return err
+	}
+	return writeSecretFile(path, b)
+}
+
+// alertSink : Sink for notifications.
+type alertSink interface {
+	Notify(e alertEvent) error
+}
+
+// stdoutSink : Sink outputting events to stdout as JSON.
+type stdoutSink struct{}
+
+// Notify : Output event.
+func (stdoutSink) Notify(e alertEvent) error {
+	return appendJSONLine("", e)
+}
+
+// emailSink : Sink sending events by SMTP.
+type emailSink struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Notify : Send event as an email.
+func (es *emailSink) Notify(e alertEvent) error {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n", es.From, strings.Join(es.To, ", "), e.Message)
+	fmt.Fprintf(b, "%s\r\n\r\nRule: %s\r\nModule: %s (%s)\r\nField: %s\r\nValue: %v\r\nThreshold: %v\r\nTime: %s\r\n",
+		e.Message, e.Rule, e.Module, e.ModuleID, e.Field, e.Value, e.Threshold, time.Unix(e.Time, 0).Format(time.RFC3339))
+	var auth smtp.Auth
+	if es.Username != "" {
+		auth = smtp.PlainAuth("", es.Username, es.Password, es.Host)
+	}
+	return smtp.SendMail(es.Host+":"+strconv.Itoa(es.Port), auth, es.From, es.To, b.Bytes())
+}
+
+// execSink : Sink running a command. The event is given to stdin as JSON and to the environment variables.
+type execSink struct {
+	Command string
+	Args    []string
+}
+
+// Notify : Run command.
+func (xs *execSink) Notify(e alertEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(xs.Command, xs.Args...)
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"GONETATMO_ALERT_RULE="+e.Rule,
+		"GONETATMO_ALERT_STATE="+e.State,
+		"GONETATMO_ALERT_MODULE="+e.Module,
+		"GONETATMO_ALERT_MODULE_ID="+e.ModuleID,
+		"GONETATMO_ALERT_FIELD="+e.Field,
+		"GONETATMO_ALERT_VALUE="+strconv.FormatFloat(e.Value, 'f', -1, 64),
+		"GONETATMO_ALERT_MESSAGE="+e.Message,
+	)
+	return cmd.Run()
+}
+
+// newSink : Create sink from config.
+func newSink(sc *sinkConfig) (alertSink, error) {
+	switch sc.Type {
+	case "stdout":
+		return stdoutSink{}, nil
+	case "webhook":
+		if sc.URL == "" {
+			return nil, errors.New(fmt.Sprintf("Error: Sink '%s' requires url.", sc.Name))
+		}
+		t, err := parseWebhookTemplate(sc.Template)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%v (sink '%s')", err, sc.Name))
+		}
+		return &webhook{URL: sc.URL, Headers: sc.Headers, Template: t, Secret: sc.Secret, Retry: sc.Retry}, nil
+	case "email":
+		if sc.SMTPHost == "" || sc.From == "" || len(sc.To) == 0 {
+			return nil, errors.New(fmt.Sprintf("Error: Sink '%s' requires smtp_host, from and to.", sc.Name))
+		}
+		port := sc.SMTPPort
+		if port == 0 {
+			port = 587
+		}
+		return &emailSink{Host: sc.SMTPHost, Port: port, Username: sc.Username, Password: sc.Password, From: sc.From, To: sc.To}, nil
+	case "exec":
+		if sc.Command == "" {
+			return nil, errors.New(fmt.Sprintf("Error: Sink '%s' requires command.", sc.Name))
+		}
+		return &execSink{Command: sc.Command, Args: sc.Args}, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Error: Sink '%s' has wrong type '%s'. Please use stdout, webhook, email or exec.", sc.Name, sc.Type))
+}
+
+// notify : Send events to sinks. When the rule has no sinks, all sinks are used.
+func notify(events []alertEvent, sinks map[string]alertSink, order []string) {
+	for _, e := range events {
+		names := e.sinks
+		if len(names) == 0 {
+			names = order
+		}
+		for _, n := range names {
+			if err := sinks[n].Notify(e); err != nil {
+				logf("Sink '%s' failed. %v", n, err)
+			}
+		}
+	}
+}
+
+// watch : Evaluate rules for station data every interval and notify events to sinks.
+// The states of rules are saved to the state file, so the hysteresis and the cooldown work with "--once" by cron.
+func (m *materials) watch(c *cli.Context) {
+	path := c.String("rules")
+	if path == "" {
+		path = filepath.Join(m.para.WorkDir, rulesFile)
+	}
+	ac, err := readAlertConfig(path)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	sinks := map[string]alertSink{}
+	var order []string
+	for _, sc := range ac.Sinks {
+		s, err := newSink(sc)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		sinks[sc.Name] = s
+		order = append(order, sc.Name)
+	}
+	interval, err := time.ParseDuration(c.String("interval"))
+	if err != nil || interval < time.Minute {
+		fmt.Printf("Error: Please input the interval of 1m or more. e.g. '10m'\n")
+		os.Exit(1)
+	}
+	statePath := c.String("state")
+	if statePath == "" {
+		statePath = filepath.Join(m.para.WorkDir, alertStateFile)
+	}
+	states, err := readAlertStates(statePath)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	ae := &alertEvaluator{rules: ac.Rules, states: states}
+	for {
+		if err := m.refreshIfExpiring(5 * time.Minute); err != nil {
+			logf("Error: %v", err)
+		} else if sd, err := m.client.StationsData(nil); err != nil {
+			logf("%v", err)
+		} else {
+			notify(ae.evaluate(alertTargets(newStations(sd)), time.Now()), sinks, order)
+			if err := saveAlertStates(statePath, ae.states); err != nil {
+				logf("Error: Couldn't save state file. %v", err)
+			}
+		}
+		if c.Bool("once") {
+			return
+		}
+		time.Sleep(interval)
+	}
+}
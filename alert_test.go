@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// co2Target : Target of a module having CO2 of v.
+func co2Target(v float64) []alertTarget {
+	return []alertTarget{{ID: "70:ee:50:00:00:00", Name: "Home Indoor", TimeUtc: 1, Values: map[string]float64{"co2": v}}}
+}
+
+func TestAlertCooldown(t *testing.T) {
+	clear := 1000.0
+	ae := &alertEvaluator{rules: []*alertRule{{Name: "CO2 is high", Field: "co2", Op: ">", Value: 1200, Clear: &clear, cooldown: time.Hour}}}
+	start := time.Unix(1600000000, 0)
+	steps := []struct {
+		min   int
+		co2   float64
+		state string
+	}{
+		{0, 1300, "firing"},
+		{10, 900, "resolved"},
+		{20, 1300, ""},        // Fires again within the cooldown. It is kept pending.
+		{30, 1100, ""},        // Between clear and value. It is still firing.
+		{60, 1300, "firing"},  // The cooldown ended while it is firing.
+		{70, 1300, ""},        // Already notified.
+		{80, 900, "resolved"}, // Resolved after the notification.
+		{90, 1300, ""},        // Within the cooldown.
+		{100, 900, ""},        // Resolved before the notification, so nothing is notified.
+		{150, 1300, "firing"},
+	}
+	for _, s := range steps {
+		events := ae.evaluate(co2Target(s.co2), start.Add(time.Duration(s.min)*time.Minute))
+		state := ""
+		if len(events) > 0 {
+			state = events[0].State
+		}
+		if len(events) > 1 || state != s.state {
+			t.Fatalf("%d min, CO2 %v: events = %v, want %q", s.min, s.co2, events, s.state)
+		}
+	}
+}
+
+func TestAlertStatesBetweenRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), alertStateFile)
+	rules := []*alertRule{{Name: "CO2 is high", Field: "co2", Op: ">", Value: 1200, cooldown: time.Hour}}
+	start := time.Unix(1600000000, 0)
+	// Each run of "watch --once" reads the states saved by the previous run.
+	run := func(min int, co2 float64) []alertEvent {
+		states, err := readAlertStates(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ae := &alertEvaluator{rules: rules, states: states}
+		events := ae.evaluate(co2Target(co2), start.Add(time.Duration(min)*time.Minute))
+		if err := saveAlertStates(path, ae.states); err != nil {
+			t.Fatal(err)
+		}
+		return events
+	}
+	if events := run(0, 1300); len(events) != 1 {
+		t.Fatalf("first run: events = %v, want firing", events)
+	}
+	if events := run(10, 1300); len(events) != 0 {
+		t.Fatalf("second run: events = %v, want nothing while it is firing", events)
+	}
+	if events := run(20, 1100); len(events) != 1 || events[0].State != "resolved" {
+		t.Fatalf("third run: events = %v, want resolved", events)
+	}
+}
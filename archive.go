@@ -0,0 +1,310 @@
+// Package main (archive.go) :
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tanaikech/gonetatmo/netatmo"
+	"github.com/urfave/cli"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	archiveFile = "gonetatmo.db"
+)
+
+var (
+	modulesBucket  = []byte("modules")
+	measuresBucket = []byte("measures")
+)
+
+// archive : Local archive of measurements. Values are stored as measures/<device ID>/<module ID>/<type>/<timestamp>.
+type archive struct {
+	db *bolt.DB
+}
+
+// archiveModule : Module stored in the archive.
+type archiveModule struct {
+	DeviceID    string   `json:"device_id"`
+	ModuleID    string   `json:"module_id"`
+	StationName string   `json:"station_name"`
+	ModuleName  string   `json:"module_name"`
+	Type        string   `json:"type"`
+	Types       []string `json:"types"`
+	LastTime    int64    `json:"last_time"` // Timestamp of the last stored value.
+}
+
+// key : Key of module.
+func (am *archiveModule) key() []byte {
+	return []byte(am.DeviceID + "/" + am.ModuleID)
+}
+
+// name : Name of module for displaying.
+func (am *archiveModule) name() string {
+	if am.ModuleName != "" {
+		return am.ModuleName
+	}
+	return am.ModuleID
+}
+
+// archivePath : Retrieve the path of archive.
+func (m *materials) archivePath(c *cli.Context) string {
+	if c.String("db") != "" {
+		return c.String("db")
+	}
+	return filepath.Join(m.para.WorkDir, archiveFile)
+}
+
+// openArchive : Open the archive. When the file is not existing, it is created.
+func openArchive(path string) (*archive, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error: Couldn't open the archive '%s'. %v", path, err))
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{modulesBucket, measuresBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &archive{db: db}, nil
+}
+
+// openArchiveReadOnly : Open the archive for reading. The archive is not created and not changed.
+// When sync or daemon is writing the archive, this waits for it until the timeout.
+func openArchiveReadOnly(path string) (*archive, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, errors.New(fmt.Sprintf("Error: Couldn't open the archive '%s'. %v\nPlease create it by sync.\n\n $ gonetatmo sync\n", path, err))
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 10 * time.Second, ReadOnly: true})
+	if err == bolt.ErrTimeout {
+		return nil, errors.New(fmt.Sprintf("Error: The archive '%s' is used by sync or daemon. Please run again after it finishes.", path))
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error: Couldn't open the archive '%s'. %v", path, err))
+	}
+	return &archive{db: db}, nil
+}
+
+// Close : Close the archive.
+func (a *archive) Close() error {
+	return a.db.Close()
+}
+
+// module : Retrieve the stored module. When it is not stored, nil is returned.
+func (a *archive) module(key []byte) (*archiveModule, error) {
+	var am *archiveModule
+	err := a.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(modulesBucket).Get(key)
+		if v == nil {
+			return nil
+		}
+		am = &archiveModule{}
+		return json.Unmarshal(v, am)
+	})
+	return am, err
+}
+
+// modules : Retrieve all stored modules.
+func (a *archive) modules() ([]archiveModule, error) {
+	var ams []archiveModule
+	err := a.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(modulesBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			am := archiveModule{}
+			if err := json.Unmarshal(v, &am); err != nil {
+				return err
+			}
+			ams = append(ams, am)
+			return nil
+		})
+	})
+	return ams, err
+}
+
+// putPoints : Store values of module and update the module. The number of stored values is returned.
+func (a *archive) putPoints(am *archiveModule, points []netatmo.MeasurePoint) (int, error) {
+	n := 0
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		mb, err := tx.Bucket(measuresBucket).CreateBucketIfNotExists(am.key())
+		if err != nil {
+			return err
+		}
+		for i, t := range am.Types {
+			tb, err := mb.CreateBucketIfNotExists([]byte(t))
+			if err != nil {
+				return err
+			}
+			for _, p := range points {
+				if i >= len(p.Values) || p.Values[i] == nil {
+					continue
+				}
+				if err := tb.Put(encodeTime(p.Time), encodeValue(*p.Values[i])); err != nil {
+					return err
+				}
+				n++
+			}
+		}
+		if len(points) > 0 && points[len(points)-1].Time > am.LastTime {
+			am.LastTime = points[len(points)-1].Time
+		}
+		v, err := json.Marshal(am)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(modulesBucket).Put(am.key(), v)
+	})
+	return n, err
+}
+
+// encodeTime : Encode timestamp as the sortable key.
+func encodeTime(t int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(t))
+	return b
+}
+
+// decodeTime : Decode the key to timestamp.
+func decodeTime(b []byte) int64 {
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+// encodeValue : Encode value.
+func encodeValue(v float64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, math.Float64bits(v))
+	return b
+}
+
+// decodeValue : Decode value.
+func decodeValue(b []byte) float64 {
+	return math.Float64frombits(binary.BigEndian.Uint64(b))
+}
+
+// archiveModules : Retrieve modules for archiving from stations data.
+func archiveModules(sd *netatmo.StationsData) []*archiveModule {
+	var ams []*archiveModule
+	for _, d := range sd.Body.Devices {
+		ams = append(ams, &archiveModule{
+			DeviceID:    d.ID,
+			ModuleID:    d.ID,
+			StationName: d.StationName,
+			ModuleName:  d.ModuleName,
+			Type:        d.Type,
+			Types:       netatmo.MeasureTypes(d.Type),
+			LastTime:    d.DateSetup,
+		})
+		for _, f := range d.Modules {
+			ams = append(ams, &archiveModule{
+				DeviceID:    d.ID,
+				ModuleID:    f.ID,
+				StationName: d.StationName,
+				ModuleName:  f.ModuleName,
+				Type:        f.Type,
+				Types:       netatmo.MeasureTypes(f.Type),
+				LastTime:    f.LastSetup,
+			})
+		}
+	}
+	return ams
+}
+
+// syncArchive : Store measurements of all devices and modules to the archive of path. Each run resumes from the last stored value.
+// datebegin is used for modules which are not stored yet. When it is zero, the date of setup is used.
+// The values are stored for each page of getmeasure, so the stored values are kept when a request fails on the way.
+// When a module fails, the error is logged and the next module is synced.
+func (m *materials) syncArchive(path, scale string, datebegin time.Time) error {
+	sd, err := m.client.StationsData(nil)
+	if err != nil {
+		return err
+	}
+	ar, err := openArchive(path)
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+	var failed []string
+	for _, am := range archiveModules(sd) {
+		if len(am.Types) == 0 {
+			continue
+		}
+		stored, err := ar.module(am.key())
+		if err != nil {
+			return err
+		}
+		begin := time.Unix(am.LastTime, 0)
+		if stored != nil && stored.LastTime > 0 {
+			begin = time.Unix(stored.LastTime+1, 0)
+			am.LastTime = stored.LastTime
+		} else if !datebegin.IsZero() {
+			begin = datebegin
+		}
+		if stored == nil {
+			am.LastTime = begin.Unix() - 1
+		}
+		opt := &netatmo.MeasureOptions{
+			DeviceID:  am.DeviceID,
+			Scale:     scale,
+			Types:     am.Types,
+			DateBegin: begin,
+			DateEnd:   time.Now(),
+			RealTime:  scale != "max",
+		}
+		if am.ModuleID != am.DeviceID {
+			opt.ModuleID = am.ModuleID
+		}
+		total := 0
+		err = m.client.MeasurePages(opt, func(points []netatmo.MeasurePoint) error {
+			n, err := ar.putPoints(am, points)
+			if err != nil {
+				return err
+			}
+			total += n
+			fmt.Fprintf(os.Stderr, "%s: Stored %d values until %s.\n", am.name(), total, time.Unix(am.LastTime, 0).In(time.Local).Format("20060102 15:04:05 MST"))
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s (%s): %v\n", am.name(), am.ModuleID, err)
+			failed = append(failed, am.name())
+			continue
+		}
+		fmt.Printf("%s (%s): Stored %d values. Last time is %s.\n", am.name(), am.ModuleID, total, time.Unix(am.LastTime, 0).In(time.Local).Format("20060102 15:04:05 MST"))
+	}
+	if len(failed) > 0 {
+		return errors.New(fmt.Sprintf("Error: Couldn't sync %s. The stored values are kept and the next sync resumes from them.", strings.Join(failed, ", ")))
+	}
+	return nil
+}
+
+// sync : Store measurements of all devices and modules to the archive.
+func (m *materials) sync(c *cli.Context) {
+	var datebegin time.Time
+	if c.String("datebegin") != "" {
+		var err error
+		if datebegin, err = time.Parse(time.RFC3339Nano, c.String("datebegin")); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := m.syncArchive(m.archivePath(c), c.String("scale"), datebegin); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tanaikech/gonetatmo/netatmo"
+)
+
+func TestSyncArchiveStoresEachPage(t *testing.T) {
+	start := int64(1600000200)
+	deviceCalls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/getstationsdata"):
+			fmt.Fprintf(w, `{"body":{"devices":[{"_id":"70:ee:50:00:00:01","station_name":"Home","module_name":"Indoor","type":"NAMain","date_setup":%d,
+				"modules":[{"_id":"02:00:00:00:00:01","module_name":"Outdoor","type":"NAModule1","last_setup":%d}]}]},"status":"ok"}`, start, start)
+		case q.Get("module_id") != "":
+			begin, _ := strconv.ParseInt(q.Get("date_begin"), 10, 64)
+			if begin > start {
+				fmt.Fprint(w, `{"body":[],"status":"ok"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"body":[{"beg_time":%d,"step_time":300,"value":[[1],[2],[3]]}],"status":"ok"}`, start)
+		default:
+			// The first page of the device is full and the second page fails.
+			deviceCalls++
+			if deviceCalls > 1 {
+				http.Error(w, `{"error":{"code":21,"message":"Invalid argument"}}`, http.StatusBadRequest)
+				return
+			}
+			values := make([]string, 1024)
+			for i := range values {
+				values[i] = fmt.Sprintf("[%d]", i)
+			}
+			fmt.Fprintf(w, `{"body":[{"beg_time":%d,"step_time":300,"value":[%s]}],"status":"ok"}`, start, strings.Join(values, ","))
+		}
+	}))
+	defer srv.Close()
+	m := initParams()
+	m.client = &netatmo.Client{BaseURL: srv.URL, Tokens: netatmo.StaticToken("token")}
+	path := filepath.Join(t.TempDir(), archiveFile)
+	if err := m.syncArchive(path, "max", time.Time{}); err == nil || !strings.Contains(err.Error(), "Indoor") {
+		t.Fatalf("error = %v, want the error of the device", err)
+	}
+	ar, err := openArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ar.Close()
+	ams, err := ar.modules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]struct {
+		n    int
+		last int64
+	}{
+		"70:ee:50:00:00:01": {1024, start + 1023*300}, // The page before the error is stored.
+		"02:00:00:00:00:01": {3, start + 2*300},       // The module after the error is synced.
+	}
+	for _, am := range ams {
+		ts, _, err := ar.values(&am, "Temperature", 0, math.MaxInt64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := want[am.ModuleID]
+		if len(ts) != w.n || am.LastTime != w.last {
+			t.Errorf("%s: values = %d, last time = %d, want %d, %d", am.ModuleID, len(ts), am.LastTime, w.n, w.last)
+		}
+		delete(want, am.ModuleID)
+	}
+	if len(want) > 0 {
+		t.Errorf("modules are not stored: %v", want)
+	}
+}
+
+func TestOpenArchiveReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), archiveFile)
+	if _, err := openArchiveReadOnly(path); err == nil {
+		t.Fatal("missing archive is not an error")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("missing archive was created. %v", err)
+	}
+	ar, err := openArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ar.Close()
+	ro, err := openArchiveReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	if !ro.db.IsReadOnly() {
+		t.Error("archive is not opened as read-only")
+	}
+	if _, err := ro.modules(); err != nil {
+		t.Error(err)
+	}
+}
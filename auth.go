@@ -5,11 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/tanaikech/gonetatmo/netatmo"
@@ -17,11 +17,26 @@ import (
 )
 
 const (
-	cfgFile    = "gonetatmo.cfg"
-	scope      = "read_station"
-	cfgpathenv = "GONETATMO_CFG_PATH"
+	cfgFile      = "gonetatmo.cfg"
+	defaultScope = "read_station"
+	cfgpathenv   = "GONETATMO_CFG_PATH"
 )
 
+// knownScopes : Scopes of Netatmo. https://dev.netatmo.com/apidocumentation/oauth#scopes
+var knownScopes = []string{
+	"read_station",
+	"read_thermostat", "write_thermostat",
+	"read_camera", "write_camera", "access_camera",
+	"read_presence", "write_presence", "access_presence",
+	"read_doorbell", "access_doorbell",
+	"read_smokedetector", "read_carbonmonoxidedetector",
+	"read_homecoach",
+	"read_magellan", "write_magellan",
+	"read_bubendorff", "write_bubendorff",
+	"read_smarther", "write_smarther",
+	"read_mx", "write_mx",
+}
+
 // para : Initial parameters
 type para struct {
 	pstart  time.Time
@@ -41,12 +56,23 @@ type tokens struct {
 
 // configFile : Structure for config file
 type configFile struct {
-	ClientId     string `json:"client_id"`
-	ClientSecret string `json:"client_secret"`
-	Mail         string `json:"-"`
-	Pass         string `json:"-"`
+	ClientId     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes,omitempty"` // Scopes requested at the authorization.
+	Mail         string   `json:"-"`
+	Pass         string   `json:"-"`
 	*tokens
-	GoogleApiKey string `json:"google_api_key"`
+	GoogleApiKey string            `json:"google_api_key"`
+	Options      map[string]string `json:"options,omitempty"` // Default values of flags for this profile.
+}
+
+// UnmarshalJSON : Allocate tokens before decoding, because the embedded pointer of the unexported type cannot be allocated by encoding/json.
+func (cf *configFile) UnmarshalJSON(b []byte) error {
+	type alias configFile
+	if cf.tokens == nil {
+		cf.tokens = &tokens{}
+	}
+	return json.Unmarshal(b, (*alias)(cf))
 }
 
 // materials : Materials for this application
@@ -54,84 +80,269 @@ type materials struct {
 	*para
 	*tokens
 	*configFile
+	client   *netatmo.Client
+	store    secretStore
+	profiles *profilesFile
+	profile  string            // Name of profile selected by "--profile".
+	cred     map[string]string // Credentials resolved from flags, files and environment variables.
+}
+
+// Token : Return the access token in the config file. This is used as netatmo.TokenSource.
+func (m *materials) Token() (string, error) {
+	return m.configFile.tokens.Accesstoken, nil
+}
+
+// cfgPath : Path of the config file.
+func (m *materials) cfgPath() string {
+	return filepath.Join(m.para.WorkDir, cfgFile)
+}
+
+// secretStore : Retrieve the store of the config file.
+func (m *materials) secretStore() (secretStore, error) {
+	if m.store == nil {
+		s, err := detectStore(m.cfgPath())
+		if err != nil {
+			return nil, err
+		}
+		m.store = s
+	}
+	return m.store, nil
+}
+
+// readcfgfile : Read the config file from the store and select the profile.
+func (m *materials) readcfgfile() error {
+	if err := m.loadProfiles(); err != nil {
+		return err
+	}
+	return m.selectProfile(false)
 }
 
-// makecfgfile :
-func (m *materials) makecfgfile() {
-	file, _ := json.MarshalIndent(m.configFile, "", "\t")
-	ioutil.WriteFile(filepath.Join(m.para.WorkDir, cfgFile), file, 0777)
-	fmt.Printf("Updated '%s' at %s. \n", cfgFile, m.para.WorkDir)
+// lockCfg : Lock the config file among processes. Please call the returned function for unlocking.
+func (m *materials) lockCfg() (func(), error) {
+	unlock, err := lockFile(m.cfgPath() + ".lock")
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error: Couldn't lock '%s'. %v", cfgFile, err))
+	}
+	return unlock, nil
 }
 
-// getTokens : Retrieve tokens.
+// makecfgfile : Save the selected profile holding the lock of the config file.
+func (m *materials) makecfgfile() error {
+	unlock, err := m.lockCfg()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return m.writecfgfile()
+}
+
+// writecfgfile : Save the selected profile. The config file is read again and only the selected profile is replaced,
+// so the other profiles updated by other processes are kept. Please hold the lock by lockCfg.
+func (m *materials) writecfgfile() error {
+	name, cf := m.profileName(), m.configFile
+	return m.updateProfiles(func(pf *profilesFile) { pf.Profiles[name] = cf })
+}
+
+// getTokens : Retrieve tokens. The tokens are not saved, so please save them by makecfgfile or writecfgfile.
 func (m *materials) getTokens(body []byte) {
 	json.Unmarshal(body, &m.tokens)
 	m.configFile.tokens = m.tokens
-	m.tokens.EndTime = m.para.pstart.Unix() + m.tokens.ExpiresIn
+	m.tokens.EndTime = time.Now().Unix() + m.tokens.ExpiresIn
 	m.tokens.EndTimeDate = time.Unix(m.tokens.EndTime, 0).In(time.Local).Format("20060102_15:04:05_MST")
-	m.makecfgfile()
 }
 
-// getAccesstokenByRefreshtoken : Retrieve access token by existing refresh token.
+// getAccesstokenByRefreshtoken : Retrieve access token by existing refresh token. Please use refreshTokens for holding the lock.
+// Netatmo invalidates the used refresh token, so when the new tokens couldn't be saved, the error is returned.
 func (m *materials) getAccesstokenByRefreshtoken() error {
 	tokenparams := url.Values{}
 	tokenparams.Set("grant_type", "refresh_token")
 	tokenparams.Set("refresh_token", m.configFile.tokens.Refreshtoken)
-	tokenparams.Set("client_id", m.configFile.ClientId)
-	tokenparams.Set("client_secret", m.configFile.ClientSecret)
+	tokenparams.Set("client_id", m.clientID())
+	tokenparams.Set("client_secret", m.clientSecret())
 	body, err := netatmo.GetTokens(tokenparams)
+	if netatmo.IsInvalidToken(err) {
+		return errors.New(fmt.Sprintf("%v\nRefresh token is broken or revoked. Please authorize gonetatmo again.\n\n $ gonetatmo auth login\n", err))
+	}
 	if err != nil {
 		return err
 	}
 	m.getTokens(body)
+	if err := m.writecfgfile(); err != nil {
+		return errors.New(fmt.Sprintf("%v\nThe new tokens couldn't be saved, and the old refresh token was invalidated by Netatmo. Please authorize gonetatmo again.\n\n $ gonetatmo auth login\n", err))
+	}
 	return nil
 }
 
+// refreshTokens : Retrieve new access token holding the lock of the config file, so only one process uses the refresh token.
+// The config file is read again after the lock is acquired. When another process has already retrieved the access token
+// which doesn't expire within margin, it is used. When force is true, the access token is always retrieved.
+func (m *materials) refreshTokens(margin time.Duration, force bool) error {
+	unlock, err := m.lockCfg()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := m.readcfgfile(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if !force && m.configFile.tokens.Accesstoken != "" && time.Now().Add(margin).Unix() < m.configFile.tokens.EndTime {
+		return nil
+	}
+	return m.getAccesstokenByRefreshtoken()
+}
+
+// Refresh : Retrieve new access token because Netatmo rejected the current one. This is used as netatmo.Refresher.
+// When another process has already retrieved new access token, it is used without using the refresh token.
+func (m *materials) Refresh() error {
+	rejected := m.configFile.tokens.Accesstoken
+	unlock, err := m.lockCfg()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := m.readcfgfile(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if m.configFile.tokens.Accesstoken != "" && m.configFile.tokens.Accesstoken != rejected && time.Now().Unix() < m.configFile.tokens.EndTime {
+		return nil
+	}
+	if m.configFile.tokens.Refreshtoken == "" {
+		return errors.New("Error: Access token was rejected and there is no refresh token. Please authorize again.\n\n $ gonetatmo auth login\n")
+	}
+	return m.getAccesstokenByRefreshtoken()
+}
+
+// refreshIfExpiring : Retrieve new access token when it expires within margin. This is used by long-running commands.
+func (m *materials) refreshIfExpiring(margin time.Duration) error {
+	if m.configFile.tokens.Accesstoken != "" && time.Now().Add(margin).Unix() < m.configFile.tokens.EndTime {
+		return nil
+	}
+	return m.refreshTokens(margin, false)
+}
+
 // getNewRefreshtoken : Retrieve new refresh token.
 func (m *materials) getNewRefreshtoken() error {
 	tokenparams := url.Values{}
 	tokenparams.Set("grant_type", "password")
-	tokenparams.Set("client_id", m.configFile.ClientId)
-	tokenparams.Set("client_secret", m.configFile.ClientSecret)
+	tokenparams.Set("client_id", m.clientID())
+	tokenparams.Set("client_secret", m.clientSecret())
 	tokenparams.Set("username", m.configFile.Mail)
 	tokenparams.Set("password", m.configFile.Pass)
-	tokenparams.Set("scope", scope)
+	tokenparams.Set("scope", m.scope())
 	body, err := netatmo.GetTokens(tokenparams)
 	if err != nil {
 		return err
 	}
 	m.getTokens(body)
-	return nil
+	return m.makecfgfile()
+}
+
+// scope : Retrieve the requested scopes separated by spaces.
+func (m *materials) scope() string {
+	if len(m.configFile.Scopes) == 0 {
+		return defaultScope
+	}
+	return strings.Join(m.configFile.Scopes, " ")
+}
+
+// parseScopes : Parse scopes separated by "," or spaces.
+func parseScopes(s string) ([]string, error) {
+	var res []string
+	for _, e := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		known := false
+		for _, k := range knownScopes {
+			if e == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, errors.New(fmt.Sprintf("Error: Unknown scope '%s'. Please select from %s.", e, strings.Join(knownScopes, ", ")))
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+// chkScopes : Check whether the access token has defaultScope. All commands use the APIs of the weather station
+// (getstationsdata, getmeasure and getpublicdata), so they require "read_station".
+// When the granted scopes are unknown like the old config file, the check is skipped.
+func (m *materials) chkScopes() error {
+	granted := m.configFile.tokens.Scope
+	if len(granted) == 0 {
+		return nil
+	}
+	for _, g := range granted {
+		if g == defaultScope {
+			return nil
+		}
+	}
+	all := append(append([]string{}, granted...), defaultScope)
+	return errors.New(fmt.Sprintf("The access token doesn't have the scope '%s' required for this command. Please authorize again with the scopes.\n\n $ gonetatmo auth login --scope %s\n", defaultScope, strings.Join(all, ",")))
 }
 
 // chkParamsForTokens : Check parameters for retrieving tokens.
 func (m *materials) chkParamsForTokens(c *cli.Context) bool {
 	if c.String("googleapikey") != "" {
-		m.configFile.GoogleApiKey = c.String("googleapikey")
-	}
-	if c.String("clientid") != "" && c.String("clientsecret") != "" && c.String("email") != "" && c.String("password") != "" {
-		m.configFile.ClientId = c.String("clientid")
-		m.configFile.ClientSecret = c.String("clientsecret")
-		m.configFile.Mail = c.String("email")
-		m.configFile.Pass = c.String("password")
-		m.getNewRefreshtoken()
+		m.configFile.GoogleApiKey = m.cred["googleapikey"]
+	}
+	if m.cred["clientid"] != "" && m.cred["clientsecret"] != "" && m.cred["email"] != "" && m.cred["password"] != "" {
+		m.configFile.ClientId = m.cred["clientid"]
+		m.configFile.ClientSecret = m.cred["clientsecret"]
+		m.configFile.Mail = m.cred["email"]
+		m.configFile.Pass = m.cred["password"]
+		if err := m.getNewRefreshtoken(); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
 		return true
 	}
 	return false
 }
 
-// chkCfg : Check config file.
+// clientID : Retrieve client id. The resolved credential is used in priority to the config file, and it is not saved.
+func (m *materials) clientID() string {
+	if m.cred["clientid"] != "" {
+		return m.cred["clientid"]
+	}
+	return m.configFile.ClientId
+}
+
+// clientSecret : Retrieve client secret. The resolved credential is used in priority to the config file, and it is not saved.
+func (m *materials) clientSecret() string {
+	if m.cred["clientsecret"] != "" {
+		return m.cred["clientsecret"]
+	}
+	return m.configFile.ClientSecret
+}
+
+// googleAPIKey : Retrieve API key of Google. The resolved credential is used in priority to the config file.
+func (m *materials) googleAPIKey() string {
+	if m.cred["googleapikey"] != "" {
+		return m.cred["googleapikey"]
+	}
+	return m.configFile.GoogleApiKey
+}
+
+// chkCfg : Check config file. Credentials are resolved in the order of the flag, the flag of the file,
+// the environment variable, the environment variable of the file and the config file. Please see credential.
 func (m *materials) chkCfg(c *cli.Context) error {
 	var err error
-	var cfg []byte
+	if err = m.resolveCredentials(c); err != nil {
+		return err
+	}
 	if !m.chkParamsForTokens(c) {
-		if cfg, err = ioutil.ReadFile(filepath.Join(m.para.WorkDir, cfgFile)); err == nil {
-			if err = json.Unmarshal(cfg, &m.configFile); err == nil {
+		if err = m.readcfgfile(); err == nil || !os.IsNotExist(err) {
+			if err == nil {
 				if (m.para.pstart.Unix()-m.configFile.tokens.EndTime) > 0 || m.configFile.tokens.Accesstoken == "" {
-					err = m.getAccesstokenByRefreshtoken()
+					err = m.refreshTokens(0, false)
 				} else if c.String("googleapikey") != "" {
-					m.configFile.GoogleApiKey = c.String("googleapikey")
-					m.makecfgfile()
+					name, key := m.profileName(), m.cred["googleapikey"]
+					err = m.saveProfiles(func(pf *profilesFile) {
+						if cf, ok := pf.Profiles[name]; ok {
+							cf.GoogleApiKey = key
+						}
+					})
 				}
 				return err
 			} else {
@@ -139,7 +350,7 @@ func (m *materials) chkCfg(c *cli.Context) error {
 			}
 		} else {
 			if !m.chkParamsForTokens(c) {
-				return errors.New("No parameters for retrieving refresh token. Please run with the parameters of client id, client secret, mail address and password for Netatmo, again.\nYou can see HELP by\n\n $ gonetatmo --help\n\nCommand for retrieving access token of Netatmo is\n\n $ gonetatmo --clientid ### --clientsecret ### --email ### --password ###\n")
+				return errors.New("No tokens. Please authorize gonetatmo with the client id and client secret of your application.\nYou can see HELP by\n\n $ gonetatmo --help\n\nCommand for retrieving access token of Netatmo is\n\n $ gonetatmo auth login --clientid ### --clientsecret ###\n")
 			}
 			return nil
 		}
@@ -165,6 +376,11 @@ func initParams() *materials {
 		&configFile{
 			tokens: &tokens{},
 		},
+		nil,
+		nil,
+		nil,
+		"",
+		nil,
 	}
 	m.para.pstart = time.Now()
 	m.para.WorkDir = cfgDir
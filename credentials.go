@@ -0,0 +1,114 @@
+// Package main (credentials.go) :
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+	"golang.org/x/term"
+)
+
+// credentialEnvs : Environment variables for credentials. "<name>_FILE" is the file including the value.
+var credentialEnvs = map[string]string{
+	"clientid":     "GONETATMO_CLIENT_ID",
+	"clientsecret": "GONETATMO_CLIENT_SECRET",
+	"email":        "GONETATMO_EMAIL",
+	"password":     "GONETATMO_PASSWORD",
+	"googleapikey": "GONETATMO_GOOGLE_API_KEY",
+}
+
+// credentialNames : Names of credentials in the order of the prompt.
+var credentialNames = []string{"clientid", "clientsecret", "email", "password", "googleapikey"}
+
+// secretCredentials : Credentials which are not echoed at the prompt.
+var secretCredentials = map[string]bool{
+	"clientsecret": true,
+	"password":     true,
+	"googleapikey": true,
+}
+
+// credentialFileFlags : Flags of "<name>-file" for credentials.
+func credentialFileFlags(names ...string) []cli.Flag {
+	var flags []cli.Flag
+	for _, n := range names {
+		flags = append(flags, &cli.StringFlag{
+			Name:  n + "-file",
+			Usage: "File including " + n + ". This is used instead of '--" + n + "' for not leaking it to the shell history and the process list.",
+		})
+	}
+	return flags
+}
+
+// readCredentialFile : Read a credential from file. The trailing newline is removed.
+func readCredentialFile(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Error: Couldn't read the credential file. %v", err))
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// promptCredential : Read a credential from the terminal. Secrets are not echoed.
+func promptCredential(name string) (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", errors.New(fmt.Sprintf("Error: Couldn't prompt %s, because stdin is not a terminal. Please use '--%s-file' or the environment variable '%s'.", name, name, credentialEnvs[name]))
+	}
+	fmt.Fprintf(os.Stderr, "%s: ", name)
+	if secretCredentials[name] {
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return strings.TrimSpace(string(b)), err
+	}
+	s, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && s == "" {
+		return "", err
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// credential : Resolve a credential. The precedence is as follows.
+//  1. Flag of "--<name>". "-" means the prompt.
+//  2. Flag of "--<name>-file".
+//  3. Environment variable like "GONETATMO_CLIENT_ID".
+//  4. Environment variable of the file like "GONETATMO_CLIENT_ID_FILE".
+//
+// When nothing is found, an empty string is returned and the value in the config file is used.
+func credential(c *cli.Context, name string) (string, error) {
+	if v := c.String(name); v == "-" {
+		return promptCredential(name)
+	} else if v != "" {
+		return v, nil
+	}
+	if f := c.String(name + "-file"); f != "" {
+		return readCredentialFile(f)
+	}
+	env := credentialEnvs[name]
+	if v := os.Getenv(env); v != "" {
+		return v, nil
+	}
+	if f := os.Getenv(env + "_FILE"); f != "" {
+		return readCredentialFile(f)
+	}
+	return "", nil
+}
+
+// resolveCredentials : Resolve all credentials once, so the prompt is displayed only once.
+func (m *materials) resolveCredentials(c *cli.Context) error {
+	if m.cred != nil {
+		return nil
+	}
+	m.cred = map[string]string{}
+	for _, name := range credentialNames {
+		v, err := credential(c, name)
+		if err != nil {
+			return err
+		}
+		m.cred[name] = v
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+// Package main (daemon.go) :
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+const (
+	jobsFile       = "gonetatmo.jobs.json"
+	tokenMargin    = 10 * time.Minute // Access token is refreshed when it expires within this.
+	tokenCheckTime = time.Minute      // Interval for checking the expiration of access token.
+)
+
+// daemonJob : Job of daemon.
+type daemonJob struct {
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`     // stations, sync or publicdata
+	Schedule  string  `json:"schedule"` // e.g. "@every 10m" or "*/10 * * * *"
+	Output    string  `json:"output,omitempty"`
+	DB        string  `json:"db,omitempty"`
+	Scale     string  `json:"scale,omitempty"`
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	Range     float64 `json:"range,omitempty"`
+	Types     string  `json:"types,omitempty"`
+	schedule  schedule
+	next      time.Time
+}
+
+// daemonConfig : Config of daemon.
+type daemonConfig struct {
+	Jobs []*daemonJob `json:"jobs"`
+}
+
+// logf : Output log with the time.
+func logf(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, time.Now().Format(time.RFC3339)+" "+format+"\n", a...)
+}
+
+// readDaemonConfig : Read and check jobs.
+func readDaemonConfig(path string) (*daemonConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error: Couldn't read jobs file. %v", err))
+	}
+	dc := &daemonConfig{}
+	if err := json.Unmarshal(b, dc); err != nil {
+		return nil, errors.New(fmt.Sprintf("Error: Wrong jobs file '%s'. %v", path, err))
+	}
+	if len(dc.Jobs) == 0 {
+		return nil, errors.New(fmt.Sprintf("Error: No jobs in '%s'.", path))
+	}
+	for i, j := range dc.Jobs {
+		if j.Name == "" {
+			j.Name = fmt.Sprintf("%s#%d", j.Type, i+1)
+		}
+		switch j.Type {
+		case "stations", "sync":
+		case "publicdata":
+			if j.Latitude == 0 && j.Longitude == 0 {
+				return nil, errors.New(fmt.Sprintf("Error: Job '%s' requires latitude and longitude.", j.Name))
+			}
+		default:
+			return nil, errors.New(fmt.Sprintf("Error: Job '%s' has wrong type '%s'. Please use stations, sync or publicdata.", j.Name, j.Type))
+		}
+		if j.schedule, err = parseSchedule(j.Schedule); err != nil {
+			return nil, errors.New(fmt.Sprintf("%v (job '%s')", err, j.Name))
+		}
+		if j.schedule.Next(time.Now()).IsZero() {
+			return nil, errors.New(fmt.Sprintf("Error: Schedule '%s' of job '%s' never matches.", j.Schedule, j.Name))
+		}
+	}
+	return dc, nil
+}
+
+// appendJSONLine : Append v as a line of JSON to the file of path. When path is empty, it is output to stdout.
+func appendJSONLine(path string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		fmt.Println(string(b))
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// runJob : Run job. Panics are recovered so that the daemon is not stopped.
+func (m *materials) runJob(j *daemonJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprintf("Error: Job panicked. %v", r))
+		}
+	}()
+	if err := m.refreshIfExpiring(tokenMargin); err != nil {
+		return err
+	}
+	switch j.Type {
+	case "stations":
+		sd, err := m.client.StationsData(nil)
+		if err != nil {
+			return err
+		}
+		return appendJSONLine(j.Output, map[string]interface{}{
+			"time":     time.Now().Unix(),
+			"stations": newStations(sd).Stations,
+		})
+	case "sync":
+		path := j.DB
+		if path == "" {
+			path = filepath.Join(m.para.WorkDir, archiveFile)
+		}
+		scale := j.Scale
+		if scale == "" {
+			scale = "max"
+		}
+		return m.syncArchive(path, scale, time.Time{})
+	case "publicdata":
+		r := j.Range
+		if r == 0 {
+			r = 10
+		}
+		averages, err := m.publicAverages(j.Latitude, j.Longitude, r, j.Types)
+		if err != nil {
+			return err
+		}
+		return appendJSONLine(j.Output, map[string]interface{}{
+			"time":      time.Now().Unix(),
+			"latitude":  j.Latitude,
+			"longitude": j.Longitude,
+			"range":     r,
+			"averages":  averages,
+		})
+	}
+	return nil
+}
+
+// daemon : Run jobs with the schedules until SIGINT or SIGTERM. Failures of jobs are logged and the daemon is continued.
+func (m *materials) daemon(c *cli.Context) {
+	path := c.String("jobs")
+	if path == "" {
+		path = filepath.Join(m.para.WorkDir, jobsFile)
+	}
+	dc, err := readDaemonConfig(path)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	now := time.Now()
+	for _, j := range dc.Jobs {
+		j.next = j.schedule.Next(now)
+		logf("Job '%s' (%s) is scheduled at %s.", j.Name, j.Type, j.next.Format(time.RFC3339))
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	for {
+		wait := tokenCheckTime
+		for _, j := range dc.Jobs {
+			if j.next.IsZero() {
+				continue
+			}
+			if d := time.Until(j.next); d < wait {
+				wait = d
+			}
+		}
+		if wait < 0 {
+			wait = 0
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case s := <-sig:
+			timer.Stop()
+			logf("Received %v. Stopped.", s)
+			return
+		case <-timer.C:
+		}
+		if err := m.refreshIfExpiring(tokenMargin); err != nil {
+			logf("Error: Couldn't refresh access token. %v", err)
+		}
+		for _, j := range dc.Jobs {
+			if j.next.IsZero() || time.Now().Before(j.next) {
+				continue
+			}
+			start := time.Now()
+			if err := m.runJob(j); err != nil {
+				logf("Job '%s' failed. %v", j.Name, err)
+			} else {
+				logf("Job '%s' finished in %v.", j.Name, time.Since(start).Round(time.Millisecond))
+			}
+			if j.next = j.schedule.Next(time.Now()); j.next.IsZero() {
+				logf("Job '%s' has no next time of the schedule. It is stopped.", j.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadDaemonConfigSchedule(t *testing.T) {
+	tests := []struct {
+		schedule string
+		err      string
+	}{
+		{"*/10 * * * *", ""},
+		{"@every 1h", ""},
+		{"0 0 29 2 *", ""},
+		{"0 0 31 2 *", "never matches"},
+		{"0 0 31 4,6,9,11 *", "never matches"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), jobsFile)
+		ioutil.WriteFile(path, []byte(`{"jobs": [{"name": "job", "type": "stations", "schedule": "`+tt.schedule+`"}]}`), 0600)
+		_, err := readDaemonConfig(path)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.schedule, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: error is %v, want '%s'", tt.schedule, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Package main (exporter.go) :
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tanaikech/gonetatmo/netatmo"
+	"github.com/urfave/cli"
+)
+
+// promMetric : Metric of Prometheus.
+type promMetric struct {
+	Name string
+	Help string
+	Type string
+}
+
+// promSample : Sample of a metric.
+type promSample struct {
+	Name   string
+	Labels [][2]string
+	Value  float64
+}
+
+// stationMetrics : Metrics of station data.
+var stationMetrics = []promMetric{
+	{"netatmo_temperature_celsius", "Temperature in degree Celsius.", "gauge"},
+	{"netatmo_humidity_percent", "Relative humidity in percent.", "gauge"},
+	{"netatmo_co2_ppm", "CO2 concentration in ppm.", "gauge"},
+	{"netatmo_noise_db", "Noise level in dB.", "gauge"},
+	{"netatmo_pressure_hpa", "Sea-level pressure in hPa.", "gauge"},
+	{"netatmo_absolute_pressure_hpa", "Absolute pressure in hPa.", "gauge"},
+	{"netatmo_rain_mm", "Rain in the last measurement in mm.", "gauge"},
+	{"netatmo_rain_sum_1h_mm", "Rain in the last hour in mm.", "gauge"},
+	{"netatmo_rain_sum_24h_mm", "Rain in the last 24 hours in mm.", "gauge"},
+	{"netatmo_wind_strength_kmh", "Wind strength in km/h.", "gauge"},
+	{"netatmo_wind_angle_degrees", "Wind angle in degrees.", "gauge"},
+	{"netatmo_gust_strength_kmh", "Gust strength in km/h.", "gauge"},
+	{"netatmo_gust_angle_degrees", "Gust angle in degrees.", "gauge"},
+	{"netatmo_battery_percent", "Battery level in percent.", "gauge"},
+	{"netatmo_rf_status", "Radio signal strength of module.", "gauge"},
+	{"netatmo_wifi_status", "Wifi signal strength of main module.", "gauge"},
+	{"netatmo_reachable", "1 when the module is reachable.", "gauge"},
+	{"netatmo_last_measurement_timestamp_seconds", "Unix time of the last measurement of the module.", "gauge"},
+}
+
+// exporterMetrics : Health metrics of the exporter.
+var exporterMetrics = []promMetric{
+	{"gonetatmo_up", "1 when the last fetch from Netatmo succeeded.", "gauge"},
+	{"gonetatmo_last_success_timestamp_seconds", "Unix time of the last successful fetch from Netatmo.", "gauge"},
+	{"gonetatmo_fetches_total", "Number of fetches from Netatmo.", "counter"},
+	{"gonetatmo_api_errors_total", "Number of errors of fetches from Netatmo.", "counter"},
+	{"gonetatmo_token_refresh_errors_total", "Number of errors of refreshing access token.", "counter"},
+}
+
+// exporter : Prometheus exporter for station data.
+type exporter struct {
+	m             *materials
+	mu            sync.Mutex
+	samples       []promSample
+	up            bool
+	lastSuccess   int64
+	fetches       int64
+	apiErrors     int64
+	refreshErrors int64
+}
+
+// boolValue : Convert bool to the value of metric.
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// stationSamples : Create samples from stations data.
+func stationSamples(sd *netatmo.StationsData) []promSample {
+	var samples []promSample
+	add := func(labels [][2]string, name string, v float64) {
+		samples = append(samples, promSample{Name: name, Labels: labels, Value: v})
+	}
+	for _, d := range sd.Body.Devices {
+		labels := [][2]string{
+			{"station", d.StationName},
+			{"module", d.ModuleName},
+			{"module_id", d.ID},
+			{"type", d.Type},
+		}
+		add(labels, "netatmo_wifi_status", float64(d.WifiStatus))
+		add(labels, "netatmo_reachable", boolValue(d.Reachable))
+		if d.DashboardData.TimeUtc > 0 {
+			dd := d.DashboardData
+			add(labels, "netatmo_last_measurement_timestamp_seconds", float64(dd.TimeUtc))
+			add(labels, "netatmo_temperature_celsius", dd.Temperature)
+			add(labels, "netatmo_humidity_percent", dd.Humidity)
+			add(labels, "netatmo_co2_ppm", float64(dd.CO2))
+			add(labels, "netatmo_noise_db", float64(dd.Noise))
+			add(labels, "netatmo_pressure_hpa", dd.Pressure)
+			add(labels, "netatmo_absolute_pressure_hpa", dd.AbsolutePressure)
+		}
+		for _, f := range d.Modules {
+			labels := [][2]string{
+				{"station", d.StationName},
+				{"module", f.ModuleName},
+				{"module_id", f.ID},
+				{"type", f.Type},
+			}
+			add(labels, "netatmo_battery_percent", float64(f.BatteryPercent))
+			add(labels, "netatmo_rf_status", float64(f.RfStatus))
+			add(labels, "netatmo_reachable", boolValue(f.Reachable))
+			if !f.Reachable || f.DashboardData.TimeUtc == 0 {
+				continue
+			}
+			dd := f.DashboardData
+			add(labels, "netatmo_last_measurement_timestamp_seconds", float64(dd.TimeUtc))
+			switch f.Type {
+			case netatmo.TypeWind:
+				add(labels, "netatmo_wind_strength_kmh", float64(dd.WindStrength))
+				add(labels, "netatmo_wind_angle_degrees", float64(dd.WindAngle))
+				add(labels, "netatmo_gust_strength_kmh", float64(dd.GustStrength))
+				add(labels, "netatmo_gust_angle_degrees", float64(dd.GustAngle))
+			case netatmo.TypeRain:
+				add(labels, "netatmo_rain_mm", dd.Rain)
+				add(labels, "netatmo_rain_sum_1h_mm", dd.SumRain1)
+				add(labels, "netatmo_rain_sum_24h_mm", dd.SumRain24)
+			case netatmo.TypeIndoor:
+				add(labels, "netatmo_temperature_celsius", dd.Temperature)
+				add(labels, "netatmo_humidity_percent", dd.Humidity)
+				add(labels, "netatmo_co2_ppm", float64(dd.CO2))
+			default:
+				add(labels, "netatmo_temperature_celsius", dd.Temperature)
+				add(labels, "netatmo_humidity_percent", dd.Humidity)
+			}
+		}
+	}
+	return samples
+}
+
+// fetch : Retrieve station data and update samples.
+func (ex *exporter) fetch() {
+	ex.mu.Lock()
+	ex.fetches++
+	ex.mu.Unlock()
+	if err := ex.m.refreshIfExpiring(5 * time.Minute); err != nil {
+		fmt.Fprintf(os.Stderr, "%s Error: %v\n", time.Now().Format(time.RFC3339), err)
+		ex.mu.Lock()
+		ex.refreshErrors++
+		ex.up = false
+		ex.mu.Unlock()
+		return
+	}
+	sd, err := ex.m.client.StationsData(nil)
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s Error: %v\n", time.Now().Format(time.RFC3339), err)
+		ex.apiErrors++
+		ex.up = false
+		return
+	}
+	ex.samples = stationSamples(sd)
+	ex.up = true
+	ex.lastSuccess = time.Now().Unix()
+}
+
+// escapeLabel : Escape value of label for the text format of Prometheus.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// writeMetrics : Write samples with the text format of Prometheus.
+func writeMetrics(w *strings.Builder, metrics []promMetric, samples []promSample) {
+	byName := map[string][]promSample{}
+	for _, s := range samples {
+		byName[s.Name] = append(byName[s.Name], s)
+	}
+	for _, me := range metrics {
+		ss := byName[me.Name]
+		if len(ss) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", me.Name, me.Help, me.Name, me.Type)
+		sort.SliceStable(ss, func(i, j int) bool { return fmt.Sprint(ss[i].Labels) < fmt.Sprint(ss[j].Labels) })
+		for _, s := range ss {
+			var ls []string
+			for _, l := range s.Labels {
+				ls = append(ls, l[0]+`="`+escapeLabel(l[1])+`"`)
+			}
+			if len(ls) > 0 {
+				fmt.Fprintf(w, "%s{%s} %s\n", s.Name, strings.Join(ls, ","), strconv.FormatFloat(s.Value, 'g', -1, 64))
+			} else {
+				fmt.Fprintf(w, "%s %s\n", s.Name, strconv.FormatFloat(s.Value, 'g', -1, 64))
+			}
+		}
+	}
+}
+
+// ServeHTTP : Handler of "/metrics".
+func (ex *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ex.mu.Lock()
+	health := []promSample{
+		{Name: "gonetatmo_up", Value: boolValue(ex.up)},
+		{Name: "gonetatmo_last_success_timestamp_seconds", Value: float64(ex.lastSuccess)},
+		{Name: "gonetatmo_fetches_total", Value: float64(ex.fetches)},
+		{Name: "gonetatmo_api_errors_total", Value: float64(ex.apiErrors)},
+		{Name: "gonetatmo_token_refresh_errors_total", Value: float64(ex.refreshErrors)},
+	}
+	b := &strings.Builder{}
+	writeMetrics(b, stationMetrics, ex.samples)
+	writeMetrics(b, exporterMetrics, health)
+	ex.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprint(w, b.String())
+}
+
+// serve : Run the exporter. Station data is retrieved every interval.
+func (m *materials) serve(c *cli.Context) {
+	if !c.Bool("prometheus") {
+		fmt.Printf("Error: Please select the mode of serve.\n\n $ gonetatmo serve --prometheus\n\n")
+		os.Exit(1)
+	}
+	interval, err := time.ParseDuration(c.String("interval"))
+	if err != nil || interval < time.Minute {
+		fmt.Printf("Error: Please input the interval of 1m or more. e.g. '10m'\n")
+		os.Exit(1)
+	}
+	ex := &exporter{m: m}
+	ex.fetch()
+	go func() {
+		for range time.Tick(interval) {
+			ex.fetch()
+		}
+	}()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", ex)
+	fmt.Printf("Serving metrics at http://%s/metrics\n", c.String("listen"))
+	if err := http.ListenAndServe(c.String("listen"), mux); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
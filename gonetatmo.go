@@ -3,6 +3,7 @@ package main
 
 import (
 	"os"
+	"time"
 
 	"github.com/urfave/cli"
 )
@@ -11,6 +12,27 @@ const (
 	appname = "gonetatmo"
 )
 
+// outputFlags : Flags for the output format.
+func outputFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "format, fmt",
+			Aliases: []string{"fmt"},
+			Usage:   "Output format. You can select from table, json, csv, influx and raw. influx is InfluxDB line protocol and can be used for getstationsdata and getmeasure.",
+			Value:   "table",
+		},
+		&cli.StringFlag{
+			Name:  "delimiter",
+			Usage: "Delimiter for '--format csv'. '\\t' means a tab.",
+			Value: ",",
+		},
+		&cli.BoolFlag{
+			Name:  "noheader",
+			Usage: "Output no header row for '--format csv'.",
+		},
+	}
+}
+
 // createHelp : Create help document.
 func createHelp() *cli.App {
 	a := cli.NewApp()
@@ -32,34 +54,168 @@ func createHelp() *cli.App {
 		},
 		&cli.StringFlag{
 			Name:  "clientid",
-			Usage: "Client ID for accessing to Netatmo. You can retrieve this by registered your application at https://dev.netatmo.com/",
+			Usage: "Client ID for accessing to Netatmo. You can retrieve this by registered your application at https://dev.netatmo.com/ Also 'GONETATMO_CLIENT_ID' can be used.",
 		},
 		&cli.StringFlag{
 			Name:  "clientsecret",
-			Usage: "Client secret for accessing to Netatmo. You can retrieve this by registered your application at https://dev.netatmo.com/",
+			Usage: "Client secret for accessing to Netatmo. You can retrieve this by registered your application at https://dev.netatmo.com/ '-' prompts it without echo. Also 'GONETATMO_CLIENT_SECRET' can be used.",
 		},
 		&cli.StringFlag{
 			Name:  "email",
-			Usage: "E-mail that you use when you login to Netatmo. This is not saved to the config file.",
+			Usage: "E-mail that you use when you login to Netatmo. This is not saved to the config file. The password grant is deprecated by Netatmo, so please use 'auth login'.",
 		},
 		&cli.StringFlag{
 			Name:  "password",
-			Usage: "Password that you use when you login to Netatmo. This is not saved to the config file.",
+			Usage: "Password that you use when you login to Netatmo. This is not saved to the config file. '-' prompts it without echo. Also 'GONETATMO_PASSWORD' can be used. The password grant is deprecated by Netatmo, so please use 'auth login'.",
+		},
+		&cli.StringFlag{
+			Name:    "profile",
+			Usage:   "Name of profile in the config file. Default is the default profile of the config file or 'default'.",
+			EnvVars: []string{profileEnv},
 		},
 		&cli.StringFlag{
 			Name:    "googleapikey, key",
 			Aliases: []string{"key"},
-			Usage:   "API key for using Google Map.",
+			Usage:   "API key for using Google Map. '-' prompts it without echo. Also 'GONETATMO_GOOGLE_API_KEY' can be used.",
+		},
+		&cli.StringFlag{
+			Name:    "ratelimit",
+			Usage:   "Limits of requests to Netatmo shared by all requests in the process like '50/10s,500/1h'. 'off' disables it. Default is '50/10s,500/1h'.",
+			EnvVars: []string{"GONETATMO_RATE_LIMIT"},
 		},
 	}
+	a.Flags = append(a.Flags, credentialFileFlags("clientid", "clientsecret", "email", "password", "googleapikey")...)
+	a.Flags = append(a.Flags, outputFlags()...)
 	a.Commands = []*cli.Command{
+		{
+			Name:        "profile",
+			Usage:       "list, add, remove, default",
+			Description: "Manage the profiles in the config file. Each profile has own client id, client secret, tokens and default options. The profile is selected by '--profile'.",
+			Subcommands: []*cli.Command{
+				{
+					Name:        "list",
+					Description: "Display the profiles. '*' is the selected profile.",
+					Action:      profileHandler,
+				},
+				{
+					Name:        "add",
+					Usage:       "lab --clientid ### --clientsecret ### --option deviceid=12:34:56:78:90:12",
+					Description: "Add a profile or update it.",
+					Action:      profileHandler,
+					Flags: append([]cli.Flag{
+						&cli.StringFlag{
+							Name:  "clientid",
+							Usage: "Client ID of your application.",
+						},
+						&cli.StringFlag{
+							Name:  "clientsecret",
+							Usage: "Client secret of your application.",
+						},
+						&cli.StringFlag{
+							Name:  "scope",
+							Usage: "Scopes separated by ',' for 'auth login'.",
+						},
+						&cli.StringSliceFlag{
+							Name:  "option",
+							Usage: "Default value of a flag like 'deviceid=12:34:56:78:90:12' and 'format=json'. This can be used several times. 'key=' removes it.",
+						},
+					}, credentialFileFlags("clientid", "clientsecret")...),
+				},
+				{
+					Name:        "remove",
+					Usage:       "lab",
+					Description: "Remove a profile.",
+					Action:      profileHandler,
+				},
+				{
+					Name:        "default",
+					Usage:       "lab",
+					Description: "Set the default profile.",
+					Action:      profileHandler,
+				},
+			},
+		},
+		{
+			Name:        "auth",
+			Usage:       "login, status, refresh, logout, migrate",
+			Description: "Manage the authorization of Netatmo.",
+			Subcommands: []*cli.Command{
+				{
+					Name:        "login",
+					Usage:       "--clientid ### --clientsecret ###",
+					Description: "Retrieve tokens by the authorization code flow. The authorization URL is opened and the code is received by the local server of the redirect URI, so your password is not required.",
+					Action:      handler,
+					Flags: append([]cli.Flag{
+						&cli.StringFlag{
+							Name:  "clientid",
+							Usage: "Client ID of your application. When this is not used, 'GONETATMO_CLIENT_ID' or the value in the config file is used.",
+						},
+						&cli.StringFlag{
+							Name:  "clientsecret",
+							Usage: "Client secret of your application. '-' prompts it without echo. When this is not used, 'GONETATMO_CLIENT_SECRET' or the value in the config file is used.",
+						},
+						&cli.StringFlag{
+							Name:  "scope",
+							Usage: "Scopes separated by ',' like 'read_station,read_thermostat,read_homecoach'. When this is not used, the scopes in the config file or 'read_station' are used.",
+						},
+						&cli.StringFlag{
+							Name:  "store",
+							Usage: "Secret store for saving the config. You can select from file, encrypted and keyring. When this is not used, the current store or the environment variable 'GONETATMO_SECRET_STORE' is used.",
+						},
+						&cli.StringFlag{
+							Name:  "redirect",
+							Usage: "Redirect URI registered to your application. The local server is started at the host and the port of this.",
+							Value: redirectURI,
+						},
+						&cli.BoolFlag{
+							Name:  "noopen",
+							Usage: "Don't open the browser. Please open the displayed URL by yourself.",
+						},
+						&cli.DurationFlag{
+							Name:  "timeout",
+							Usage: "Timeout of waiting for the authorization.",
+							Value: 5 * time.Minute,
+						},
+					}, credentialFileFlags("clientid", "clientsecret")...),
+				},
+				{
+					Name:        "status",
+					Description: "Display the profile, the config file, the scopes and the expiration of the access token, and validate the access token by calling Netatmo. The exit code is 1 when the access token is not valid.",
+					Action:      handler,
+				},
+				{
+					Name:        "refresh",
+					Description: "Retrieve new access token by the refresh token even if the access token doesn't expire.",
+					Action:      handler,
+					Flags:       credentialFileFlags("clientid", "clientsecret"),
+				},
+				{
+					Name:        "logout",
+					Description: "Remove the tokens of the profile from the config file. The client id, the client secret and the options are kept.",
+					Action:      handler,
+				},
+				{
+					Name:        "migrate",
+					Usage:       "--to keyring",
+					Description: "Move the config file including client secret and tokens to the selected secret store. 'file' is JSON which only you can read, 'encrypted' is the file encrypted with a passphrase, and 'keyring' is the keyring of OS.",
+					Action:      handler,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "to",
+							Usage: "Secret store. You can select from file, encrypted and keyring.",
+							Value: "encrypted",
+						},
+					},
+				},
+			},
+		},
 		{
 			Name:        "getmeasure",
 			Aliases:     []string{"m"},
 			Usage:       "-di \"12:34:56:78:90:12\" -b 2018-01-23T12:00:00+09:00 -e 2018-01-23T13:00:00+09:00",
 			Description: "Retrieve values from device ID you have. Please read 'https://dev.netatmo.com/en-US/resources/technical/reference/common/getmeasure'.",
 			Action:      handler,
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				&cli.StringFlag{
 					Name:    "deviceid, di",
 					Aliases: []string{"di"},
@@ -98,7 +254,29 @@ func createHelp() *cli.App {
 					Usage:   "Maximum number of measurements (default and max are 1024)",
 					Value:   "1024",
 				},
-			},
+				&cli.BoolFlag{
+					Name:  "all",
+					Usage: "Retrieve all values from datebegin to dateend by requesting repeatedly over the limit. The progress is displayed to stderr. This cannot be used for the option 'raw'.",
+				},
+				&cli.StringFlag{
+					Name:  "optimize",
+					Usage: "False to retrieve values keyed by each timestamp. At default, values are retrieved as the compressed form.",
+					Value: "true",
+				},
+				&cli.BoolFlag{
+					Name:  "raw",
+					Usage: "Display raw data which retrieved from Netatmo. At default, simple data is displayed.",
+				},
+				&cli.BoolFlag{
+					Name:    "json, j",
+					Aliases: []string{"j"},
+					Usage:   "Output as json data. Default is data for displaying to terminal.",
+				},
+				&cli.BoolFlag{
+					Name:  "csv",
+					Usage: "Output as CSV data. This is the same with '--format csv'.",
+				},
+			}, outputFlags()...),
 		},
 		{
 			Name:        "getpublicdata",
@@ -106,7 +284,7 @@ func createHelp() *cli.App {
 			Usage:       "-a \"tokyo station\"",
 			Description: "Retrieve all netatmo's values and average values for area from area information. Please read 'https://dev.netatmo.com/en-US/resources/technical/reference/weatherapi/getpublicdata'.",
 			Action:      handler,
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				&cli.StringFlag{
 					Name:    "address, a",
 					Aliases: []string{"a"},
@@ -160,6 +338,264 @@ func createHelp() *cli.App {
 					Aliases: []string{"j"},
 					Usage:   "Output as json data. Default is data for displaying to terminal.",
 				},
+			}, outputFlags()...),
+		},
+		{
+			Name:        "sync",
+			Usage:       "--db ./gonetatmo.db",
+			Description: "Store measurements of all devices and modules to the local archive. Each run resumes from the last stored value.",
+			Action:      handler,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "db",
+					Usage: "Path of the archive. Default is 'gonetatmo.db' in the directory of the config file.",
+				},
+				&cli.StringFlag{
+					Name:    "scale, sc",
+					Aliases: []string{"sc"},
+					Usage:   "Timelapse between two measurements. You can select from 30min, 1hour, 3hours, 1day, 1week and 1month. max means all values.",
+					Value:   "max",
+				},
+				&cli.StringFlag{
+					Name:    "datebegin, b",
+					Aliases: []string{"b"},
+					Usage:   "Timestamp (ISO8601) of the first measure for the first run. Default is the date of setup of each module.",
+				},
+			},
+		},
+		{
+			Name:        "query",
+			Aliases:     []string{"q"},
+			Usage:       "-ty Temperature -g day -b 2018-01-01T00:00:00+09:00",
+			Description: "Display min, max, average and percentiles of values in the local archive created by 'sync'. Netatmo is not accessed.",
+			Action:      handler,
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{
+					Name:  "db",
+					Usage: "Path of the archive. Default is 'gonetatmo.db' in the directory of the config file.",
+				},
+				&cli.StringFlag{
+					Name:    "module, mo",
+					Aliases: []string{"mo"},
+					Usage:   "Name or mac address of the module. Default is all modules.",
+				},
+				&cli.StringFlag{
+					Name:    "type, ty",
+					Aliases: []string{"ty"},
+					Usage:   "Types you want. For example, 'Temperature,Humidity'. Default is all types.",
+				},
+				&cli.StringFlag{
+					Name:    "datebegin, b",
+					Aliases: []string{"b"},
+					Usage:   "Timestamp (ISO8601) of the start of the window. Default is the first stored value.",
+				},
+				&cli.StringFlag{
+					Name:    "dateend, e",
+					Aliases: []string{"e"},
+					Usage:   "Timestamp (ISO8601) of the end of the window. Default is now.",
+				},
+				&cli.StringFlag{
+					Name:    "groupby, g",
+					Aliases: []string{"g"},
+					Usage:   "Group values by hour, day, week or none.",
+					Value:   "day",
+				},
+				&cli.StringFlag{
+					Name:    "percentiles, pc",
+					Aliases: []string{"pc"},
+					Usage:   "Percentiles you want. For example, '50,90,99'.",
+					Value:   "50,90",
+				},
+			}, outputFlags()...),
+		},
+		{
+			Name:        "serve",
+			Usage:       "--prometheus --listen :9210 --interval 10m",
+			Description: "Run as a server. With '--prometheus', station data is retrieved periodically and exposed at '/metrics' for Prometheus.",
+			Action:      handler,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "prometheus",
+					Usage: "Expose station data as metrics of Prometheus.",
+				},
+				&cli.StringFlag{
+					Name:  "listen",
+					Usage: "Address for listening.",
+					Value: ":9210",
+				},
+				&cli.StringFlag{
+					Name:  "interval",
+					Usage: "Interval for retrieving station data. Netatmo updates the data every 10 minutes.",
+					Value: "10m",
+				},
+			},
+		},
+		{
+			Name:        "push",
+			Usage:       "--url \"http://localhost:8086/write?db=netatmo\" --interval 10m",
+			Description: "Push station data as InfluxDB line protocol. Without '--url', the lines are output to stdout for the exec input of Telegraf.",
+			Action:      handler,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "url",
+					Usage: "Write endpoint of InfluxDB. e.g. 'http://localhost:8086/write?db=netatmo' or 'http://localhost:8086/api/v2/write?org=###&bucket=###'",
+				},
+				&cli.StringFlag{
+					Name:  "token",
+					Usage: "Token of InfluxDB. This is used as 'Authorization: Token ###'.",
+				},
+				&cli.IntFlag{
+					Name:  "batch",
+					Usage: "Maximum number of lines for one request.",
+					Value: 5000,
+				},
+				&cli.IntFlag{
+					Name:  "retry",
+					Usage: "Number of retries when the request failed.",
+					Value: 3,
+				},
+				&cli.StringFlag{
+					Name:  "interval",
+					Usage: "Interval for pushing. e.g. '10m'. Default is pushing only once.",
+				},
+			},
+		},
+		{
+			Name:        "mqtt",
+			Usage:       "--broker tcp://localhost:1883 --interval 10m",
+			Description: "Publish station data to MQTT every interval. The discovery configs of Home Assistant are also published, so the sensors appear automatically.",
+			Action:      handler,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "broker",
+					Usage: "URL of MQTT broker.",
+					Value: "tcp://localhost:1883",
+				},
+				&cli.StringFlag{
+					Name:  "mqttuser",
+					Usage: "User name for MQTT broker.",
+				},
+				&cli.StringFlag{
+					Name:  "mqttpassword",
+					Usage: "Password for MQTT broker.",
+				},
+				&cli.StringFlag{
+					Name:  "mqttclientid",
+					Usage: "Client ID for MQTT broker.",
+					Value: appname,
+				},
+				&cli.StringFlag{
+					Name:  "topicprefix",
+					Usage: "Prefix of topics. The states are published to '<prefix>/<module ID>/state'.",
+					Value: appname,
+				},
+				&cli.StringFlag{
+					Name:  "discoveryprefix",
+					Usage: "Prefix of the discovery of Home Assistant.",
+					Value: "homeassistant",
+				},
+				&cli.BoolFlag{
+					Name:  "retain",
+					Usage: "Publish the states as retained messages.",
+				},
+				&cli.StringFlag{
+					Name:  "interval",
+					Usage: "Interval for retrieving station data. Netatmo updates the data every 10 minutes.",
+					Value: "10m",
+				},
+			},
+		},
+		{
+			Name:        "daemon",
+			Usage:       "--jobs gonetatmo.jobs.json",
+			Description: "Run jobs (stations, sync and publicdata) with the schedules like cron. The access token is refreshed before it expires, and failures of jobs are logged and retried at the next schedule.",
+			Action:      handler,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "jobs",
+					Usage: "Jobs file of JSON. Default is 'gonetatmo.jobs.json' in the working directory.",
+				},
+			},
+		},
+		{
+			Name:        "watch",
+			Usage:       "--rules gonetatmo.rules.yaml --interval 10m",
+			Description: "Evaluate the alerting rules for station data every interval and notify the firing and the resolving to sinks (stdout, webhook, email and exec).",
+			Action:      handler,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "rules",
+					Usage: "Rules file of YAML or JSON. Default is 'gonetatmo.rules.yaml' in the working directory.",
+				},
+				&cli.StringFlag{
+					Name:  "interval",
+					Usage: "Interval for evaluating. Netatmo updates the data every 10 minutes.",
+					Value: "10m",
+				},
+				&cli.BoolFlag{
+					Name:  "once",
+					Usage: "Evaluate only once. This can be used with cron.",
+				},
+				&cli.StringFlag{
+					Name:  "state",
+					Usage: "File for saving the states of rules between runs. Default is 'gonetatmo.alerts.json' in the working directory.",
+				},
+			},
+		},
+		{
+			Name:        "webhook",
+			Usage:       "--url https://hooks.slack.com/services/### --template slack",
+			Description: "Post station data and average values of public data to webhook with the payload created by text/template. The built-in templates are json, slack, discord and teams.",
+			Action:      handler,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "url",
+					Usage: "URL of webhook.",
+				},
+				&cli.StringSliceFlag{
+					Name:  "header",
+					Usage: "Header of request like 'Authorization: Bearer ###'. This can be used several times.",
+				},
+				&cli.StringFlag{
+					Name:  "template",
+					Usage: "Built-in template (json, slack, discord and teams) or text/template for the payload.",
+					Value: "json",
+				},
+				&cli.StringFlag{
+					Name:  "templatefile",
+					Usage: "File of text/template for the payload. This is used instead of '--template'.",
+				},
+				&cli.StringFlag{
+					Name:  "secret",
+					Usage: "Secret for signing the payload by HMAC-SHA256. The signature is set to 'X-Gonetatmo-Signature' as 'sha256=<hex>'.",
+				},
+				&cli.IntFlag{
+					Name:  "retry",
+					Usage: "Number of retries when the request failed.",
+					Value: 3,
+				},
+				&cli.Float64Flag{
+					Name:  "latitude",
+					Usage: "Center latitude for the average values of public data. Default is no public data.",
+				},
+				&cli.Float64Flag{
+					Name:  "longitude",
+					Usage: "Center longitude for the average values of public data.",
+				},
+				&cli.Float64Flag{
+					Name:  "range",
+					Usage: "Range of area for public data. Unit is kilometers.",
+					Value: 10,
+				},
+				&cli.StringFlag{
+					Name:  "type",
+					Usage: "Types of public data.",
+					Value: "temperature,pressure,humidity,rain,wind",
+				},
+				&cli.StringFlag{
+					Name:  "interval",
+					Usage: "Interval for posting. e.g. '1h'. Default is posting only once.",
+				},
 			},
 		},
 	}
@@ -2,8 +2,11 @@
 package main
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"strconv"
 	"strings"
@@ -66,25 +69,110 @@ func dispTable(header []string, data [][]string) {
 	table.Render()
 }
 
+// apiErrorMessage : Add the hint for the error of Netatmo.
+func apiErrorMessage(err error) string {
+	switch {
+	case netatmo.IsInvalidToken(err):
+		return fmt.Sprintf("%v\nThe access token was rejected. Please authorize gonetatmo again.\n\n $ gonetatmo auth login\n", err)
+	case netatmo.IsRateLimited(err):
+		return fmt.Sprintf("%v\nThe limit of requests to Netatmo was reached. Please wait for a while and run again.", err)
+	case netatmo.IsDeviceNotFound(err):
+		return fmt.Sprintf("%v\nThe device or the module is not found. Please confirm the ids by '$ gonetatmo'.", err)
+	}
+	return err.Error()
+}
+
+// inputtedFlag : Retrieve the context in which the flag is inputted by the command line or the environment variable.
+// The subcommand is searched before the app. When the flag is not inputted, nil is returned.
+func inputtedFlag(c *cli.Context, name string) *cli.Context {
+	for _, ctx := range c.Lineage() {
+		if ctx.IsSet(name) {
+			return ctx
+		}
+	}
+	return nil
+}
+
+// outputFlag : Retrieve the context of the flag for the output. The output flags are defined in both the app and the subcommands,
+// and the default value of the subcommand hides the global flag like "gonetatmo --format csv getmeasure".
+// So the inputted flag is used in priority, and then the flag of the subcommand is used.
+func outputFlag(c *cli.Context, name string) *cli.Context {
+	if ctx := inputtedFlag(c, name); ctx != nil {
+		return ctx
+	}
+	return c
+}
+
+// outputFormat : Retrieve the output format from inputted parameters. "raw", "json" and "csv" are prior to "format".
+func outputFormat(c *cli.Context) string {
+	switch {
+	case c.Bool("raw"):
+		return "raw"
+	case c.Bool("json"):
+		return "json"
+	case c.Bool("csv"):
+		return "csv"
+	}
+	switch f := strings.ToLower(outputFlag(c, "format").String("format")); f {
+	case "raw", "json", "csv", "influx":
+		return f
+	}
+	return "table"
+}
+
+// dispCSV : Display results as CSV using the delimiter and the header toggle.
+func dispCSV(c *cli.Context, header []string, data [][]string) {
+	w := csv.NewWriter(os.Stdout)
+	if d := []rune(outputFlag(c, "delimiter").String("delimiter")); len(d) > 0 {
+		if string(d) == "\\t" {
+			d = []rune{'\t'}
+		}
+		w.Comma = d[0]
+	}
+	if !outputFlag(c, "noheader").Bool("noheader") {
+		w.Write(header)
+	}
+	w.WriteAll(data)
+	if err := w.Error(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
 // dispGetpublicdata : Display data retrieved by getpublicdata.
-func dispGetpublicdata(inputtedTypes string, allData []byte, outRaw, outJson bool) {
-	if outRaw {
+func (m *materials) dispGetpublicdata(c *cli.Context, opt *netatmo.PublicDataOptions) {
+	format := outputFormat(c)
+	if format == "raw" {
+		allData, err := m.client.PublicDataRaw(opt)
+		if err != nil {
+			fmt.Printf("%v\n", apiErrorMessage(err))
+			os.Exit(1)
+		}
 		fmt.Println(string(allData))
 		return
 	}
-	types := strings.Split(inputtedTypes, ",")
+	pd, err := m.client.PublicData(opt)
+	if err != nil {
+		fmt.Printf("%v\n", apiErrorMessage(err))
+		os.Exit(1)
+	}
+	types := strings.Split(c.String("type"), ",")
 	for i, e := range types {
 		types[i] = strings.TrimSpace(e)
 	}
-	pubdat := parsePublicdata(types, allData)
-	if outJson {
+	pubdat := parsePublicdata(types, pd)
+	switch format {
+	case "json":
 		outjson, err := json.Marshal(pubdat)
 		if err != nil {
 			fmt.Printf("%v\n", err)
 			os.Exit(1)
 		}
 		fmt.Println(string(outjson))
-	} else {
+	case "csv":
+		header, data := createCSVForgetPublicData(setSearchValues(types), pd, pubdat)
+		dispCSV(c, header, data)
+	default:
 		cA := calcAverage(setSearchValues(types), pubdat)
 		var data [][]string
 		var header []string
@@ -94,15 +182,56 @@ func dispGetpublicdata(inputtedTypes string, allData []byte, outRaw, outJson boo
 	return
 }
 
+// publicDataOptions : Create options for getpublicdata from coordinates and inputted parameters.
+func publicDataOptions(c *cli.Context, coordinates []float64) *netatmo.PublicDataOptions {
+	opt := netatmo.NewPublicDataOptions(coordinates)
+	opt.RequiredData = c.String("requireddata")
+	opt.Filter, _ = strconv.ParseBool(c.String("filter"))
+	return opt
+}
+
+// publicAverages : Retrieve average values of public data in the square area of r kilometers on a side around the center.
+// types is a comma separated list like "temperature,rain". Averages without data are nil.
+func (m *materials) publicAverages(lat, lon, r float64, types string) ([]map[string]interface{}, error) {
+	coordinates, err := netatmo.GetCoordinates(r, lat, lon, 10)
+	if err != nil {
+		return nil, err
+	}
+	pd, err := m.client.PublicData(netatmo.NewPublicDataOptions(coordinates))
+	if err != nil {
+		return nil, err
+	}
+	if types == "" {
+		types = "temperature,pressure,humidity,rain,wind"
+	}
+	search := strings.Split(types, ",")
+	for i, e := range search {
+		search[i] = strings.TrimSpace(e)
+	}
+	pubdat := parsePublicdata(search, pd)
+	if len(pubdat) == 0 {
+		return nil, errors.New("Error: Data was not returned from Netatmo.")
+	}
+	averages := calcAverage(setSearchValues(search), pubdat)
+	for _, a := range averages {
+		for k, v := range a {
+			if f, ok := v.(float64); ok && math.IsNaN(f) {
+				a[k] = nil // NaN cannot be used for JSON.
+			}
+		}
+	}
+	return averages, nil
+}
+
 // getpublicdata : https://dev.netatmo.com/en-US/resources/technical/reference/weatherapi/getpublicdata
 func (m *materials) getpublicdata(c *cli.Context) {
-	if m.configFile.GoogleApiKey == "" {
+	if m.googleAPIKey() == "" {
 		fmt.Printf("Error: Please input your API key for using Google MAP API.\n\n $ gonetatmo --key ###\n\n")
 		os.Exit(1)
 	}
 	if c.String("address") != "" && c.Float64("latitude") == 0 && c.Float64("longitude") == 0 {
 		res, err := netatmo.Geocoding(
-			m.configFile.GoogleApiKey,
+			m.googleAPIKey(),
 			strings.Replace(c.String("address"), " ", "+", -1),
 			c.String("language"),
 		)
@@ -118,12 +247,7 @@ func (m *materials) getpublicdata(c *cli.Context) {
 				fmt.Printf("%v, %v\n", err, coordinates)
 				os.Exit(1)
 			}
-			allData, err := netatmo.Getpublicdata(c, m.configFile.tokens.Accesstoken, coordinates)
-			if err != nil {
-				fmt.Printf("%v, %v\n", err, coordinates)
-				os.Exit(1)
-			}
-			if !c.Bool("raw") && !c.Bool("json") {
+			if outputFormat(c) == "table" {
 				h := []string{"Properties", "Values"}
 				o := [][]string{
 					[]string{"Time", m.para.pstart.In(time.Local).Format("20060102 15:04:05 MST")},
@@ -138,7 +262,7 @@ func (m *materials) getpublicdata(c *cli.Context) {
 				dispTable(h, o)
 				fmt.Printf("\n")
 			}
-			dispGetpublicdata(c.String("type"), allData, c.Bool("raw"), c.Bool("json"))
+			m.dispGetpublicdata(c, publicDataOptions(c, coordinates))
 		}
 	}
 	if c.String("address") == "" && (c.Float64("latitude") != 0 || c.Float64("longitude") != 0) {
@@ -147,44 +271,123 @@ func (m *materials) getpublicdata(c *cli.Context) {
 			fmt.Printf("%v, %v\n", err, coordinates)
 			os.Exit(1)
 		}
-		allData, err := netatmo.Getpublicdata(c, m.configFile.tokens.Accesstoken, coordinates)
-		if err != nil {
-			fmt.Printf("%v, %v\n", err, allData)
-			os.Exit(1)
-		}
-		dispGetpublicdata(c.String("type"), allData, c.Bool("raw"), c.Bool("json"))
+		m.dispGetpublicdata(c, publicDataOptions(c, coordinates))
 	}
 	return
 }
 
+// measureOptions : Create options for getmeasure from inputted parameters.
+func measureOptions(c *cli.Context) (*netatmo.MeasureOptions, error) {
+	datebegin, err := time.Parse(time.RFC3339Nano, c.String("datebegin"))
+	if err != nil {
+		return nil, err
+	}
+	dateend, err := time.Parse(time.RFC3339Nano, c.String("dateend"))
+	if err != nil {
+		return nil, err
+	}
+	limit, err := strconv.Atoi(c.String("limit"))
+	if err != nil {
+		return nil, err
+	}
+	types := strings.Split(c.String("type"), ",")
+	for i, e := range types {
+		types[i] = strings.TrimSpace(e)
+	}
+	return &netatmo.MeasureOptions{
+		DeviceID:   c.String("deviceid"),
+		ModuleID:   c.String("moduleid"),
+		Scale:      c.String("scale"),
+		Types:      types,
+		DateBegin:  datebegin,
+		DateEnd:    dateend,
+		Limit:      limit,
+		RealTime:   c.String("scale") != "max",
+		NoOptimize: c.String("optimize") == "false",
+	}, nil
+}
+
 // getmeasure : https://dev.netatmo.com/resources/technical/reference/common/getmeasure
 func (m *materials) getmeasure(c *cli.Context) {
-	allData, err := netatmo.Getmeasure(c, m.configFile.tokens.Accesstoken)
+	opt, err := measureOptions(c)
 	if err != nil {
-		fmt.Printf("%v\n%v\n", err, string(allData))
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Println(string(allData))
+	format := outputFormat(c)
+	if format == "raw" {
+		allData, err := m.client.MeasureRaw(opt)
+		if err != nil {
+			fmt.Printf("%v\n", apiErrorMessage(err))
+			os.Exit(1)
+		}
+		fmt.Println(string(allData))
+		return
+	}
+	var points []netatmo.MeasurePoint
+	if c.Bool("all") {
+		points, err = m.client.MeasureAll(opt, func(n int, last time.Time) {
+			fmt.Fprintf(os.Stderr, "Retrieved %d values until %s.\n", n, last.In(time.Local).Format("20060102 15:04:05 MST"))
+		})
+	} else {
+		var me *netatmo.Measure
+		if me, err = m.client.Measure(opt); err == nil {
+			points, err = me.Points()
+		}
+	}
+	if err != nil {
+		fmt.Printf("%v\n", apiErrorMessage(err))
+		os.Exit(1)
+	}
+	res := parseMeasure(opt.Types, points)
+	switch format {
+	case "json":
+		outjson, err := json.Marshal(res)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(outjson))
+	case "csv":
+		header, data := createOutputFormatForgetmeasure(opt.Types, res, time.RFC3339)
+		dispCSV(c, header, data)
+	case "influx":
+		dispInflux(measureLines(opt, points))
+	default:
+		dispTable(createOutputFormatForgetmeasure(opt.Types, res, "20060102 15:04:05 MST"))
+	}
 	return
 }
 
 // getStationsData : https://dev.netatmo.com/resources/technical/reference/weatherstation/getstationsdata
 func (m *materials) getStationsData(c *cli.Context) {
-	allData, err := netatmo.GetStationsData(m.configFile.tokens.Accesstoken)
-	if err != nil {
-		fmt.Printf("%v\n%v\n", err, string(allData))
-		os.Exit(1)
-	}
-	if c.Bool("raw") {
+	format := outputFormat(c)
+	if format == "raw" {
+		allData, err := m.client.StationsDataRaw(nil)
+		if err != nil {
+			fmt.Printf("%v\n", apiErrorMessage(err))
+			os.Exit(1)
+		}
 		fmt.Println(string(allData))
 		return
 	}
-	sData := parseStationsData(allData)
-	if c.Bool("json") {
+	sd, err := m.client.StationsData(nil)
+	if err != nil {
+		fmt.Printf("%v\n", apiErrorMessage(err))
+		os.Exit(1)
+	}
+	sData := parseStationsData(sd)
+	od := &stations{}
+	json.Unmarshal(sData, &od)
+	switch format {
+	case "json":
 		fmt.Println(string(sData))
-	} else {
-		od := &stations{}
-		json.Unmarshal(sData, &od)
+	case "csv":
+		header, data := createCSVForgetStationsData(od)
+		dispCSV(c, header, data)
+	case "influx":
+		dispInflux(stationsLines(od))
+	default:
 		var data [][]string
 		var header []string
 		for i, e := range od.Stations {
@@ -197,15 +400,67 @@ func (m *materials) getStationsData(c *cli.Context) {
 // handler : Initialize of "para".
 func handler(c *cli.Context) error {
 	m := initParams()
+	m.profile = c.String("profile")
+	switch c.Command.Names()[0] {
+	case "query":
+		m.query(c)
+		return nil
+	case "login":
+		m.login(c)
+		return nil
+	case "migrate":
+		m.migrate(c)
+		return nil
+	case "status":
+		m.authStatus(c)
+		return nil
+	case "refresh":
+		m.authRefresh(c)
+		return nil
+	case "logout":
+		m.logout(c)
+		return nil
+	}
 	if err := m.chkCfg(c); err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
+	if err := m.chkScopes(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := m.applyOptions(c); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if c.String("ratelimit") != "" {
+		limits, err := netatmo.ParseRateLimits(c.String("ratelimit"))
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		netatmo.SetRateLimits(limits...)
+	}
+	m.client = netatmo.NewClient(m)
 	switch c.Command.Names()[0] {
 	case "getmeasure":
 		m.getmeasure(c)
 	case "getpublicdata":
 		m.getpublicdata(c)
+	case "sync":
+		m.sync(c)
+	case "serve":
+		m.serve(c)
+	case "push":
+		m.push(c)
+	case "mqtt":
+		m.mqtt(c)
+	case "daemon":
+		m.daemon(c)
+	case "watch":
+		m.watch(c)
+	case "webhook":
+		m.notifyWebhook(c)
 	default:
 		m.getStationsData(c)
 	}
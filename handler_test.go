@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func TestOutputFlags(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   map[string]string
+		args      []string
+		format    string
+		delimiter string
+		noheader  bool
+	}{
+		{"default", nil, []string{"getmeasure"}, "table", ",", false},
+		{"global flags", nil, []string{"--format", "csv", "--delimiter", ";", "--noheader", "getmeasure"}, "csv", ";", true},
+		{"alias of global flag", nil, []string{"--fmt", "csv", "getmeasure"}, "csv", ",", false},
+		{"flags of subcommand", nil, []string{"getmeasure", "--format", "json"}, "json", ",", false},
+		{"subcommand has priority", nil, []string{"--format", "csv", "getmeasure", "--format", "json"}, "json", ",", false},
+		{"option of profile", map[string]string{"format": "csv"}, []string{"getmeasure"}, "csv", ",", false},
+		{"global flag has priority to profile", map[string]string{"format": "csv"}, []string{"--format", "json", "getmeasure"}, "json", ",", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := initParams()
+			m.configFile.Options = tt.options
+			var format, delimiter string
+			var noheader bool
+			app := cli.NewApp()
+			app.Flags = outputFlags()
+			app.Commands = []*cli.Command{
+				{
+					Name:  "getmeasure",
+					Flags: outputFlags(),
+					Action: func(c *cli.Context) error {
+						if err := m.applyOptions(c); err != nil {
+							return err
+						}
+						format = outputFormat(c)
+						delimiter = outputFlag(c, "delimiter").String("delimiter")
+						noheader = outputFlag(c, "noheader").Bool("noheader")
+						return nil
+					},
+				},
+			}
+			if err := app.Run(append([]string{appname}, tt.args...)); err != nil {
+				t.Fatal(err)
+			}
+			if format != tt.format || delimiter != tt.delimiter || noheader != tt.noheader {
+				t.Errorf("format = %s, delimiter = %s, noheader = %v, want %s, %s, %v", format, delimiter, noheader, tt.format, tt.delimiter, tt.noheader)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+// Package main (influx.go) :
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tanaikech/gonetatmo/netatmo"
+	"github.com/urfave/cli"
+)
+
+const (
+	influxMeasurement = "netatmo"
+)
+
+// influxLine : Line of InfluxDB line protocol.
+type influxLine struct {
+	Tags   [][2]string
+	Fields map[string]float64
+	Time   int64 // Unix time in seconds.
+}
+
+// escapeInflux : Escape tag keys, tag values and measurement for line protocol.
+func escapeInflux(v string) string {
+	return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(v)
+}
+
+// String : Convert to line protocol. The timestamp is nanoseconds.
+func (l influxLine) String() string {
+	b := &strings.Builder{}
+	b.WriteString(escapeInflux(influxMeasurement))
+	for _, t := range l.Tags {
+		if t[1] == "" {
+			continue
+		}
+		b.WriteString("," + escapeInflux(t[0]) + "=" + escapeInflux(t[1]))
+	}
+	keys := make([]string, 0, len(l.Fields))
+	for k := range l.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		if i == 0 {
+			b.WriteString(" ")
+		} else {
+			b.WriteString(",")
+		}
+		b.WriteString(escapeInflux(k) + "=" + strconv.FormatFloat(l.Fields[k], 'f', -1, 64))
+	}
+	b.WriteString(" " + strconv.FormatInt(l.Time*int64(time.Second), 10))
+	return b.String()
+}
+
+// stationsLines : Convert parsed stations data to lines. Modules without measurement are skipped.
+func stationsLines(s *stations) []influxLine {
+	var lines []influxLine
+	for _, st := range s.Stations {
+		stationName := ""
+		for _, f := range st.Inside {
+			stationName = f.StationName
+			if f.TimeUtc == 0 {
+				continue
+			}
+			lines = append(lines, influxLine{
+				Tags: [][2]string{{"station", f.StationName}, {"module", f.ModuleName}, {"module_id", f.Id}, {"type", netatmo.TypeMain}},
+				Fields: map[string]float64{
+					"temperature":       f.Temperature,
+					"humidity":          f.Humidity,
+					"co2":               float64(f.CO2),
+					"noise":             float64(f.Noise),
+					"pressure":          f.Pressure,
+					"absolute_pressure": f.AbsolutePressure,
+					"wifi_status":       float64(f.WifiStatus),
+				},
+				Time: f.TimeUtc,
+			})
+		}
+		for _, f := range append(append([]outsideData{}, st.IndoorModule...), st.Outside...) {
+			if f.TimeUtc == 0 {
+				continue
+			}
+			fields := map[string]float64{
+				"battery_percent": float64(f.BatteryPercent),
+				"rf_status":       float64(f.RfStatus),
+			}
+			switch f.Type {
+			case netatmo.TypeWind:
+				fields["wind_strength"] = float64(f.WindStrength)
+				fields["wind_angle"] = float64(f.WindAngle)
+				fields["gust_strength"] = float64(f.GustStrength)
+				fields["gust_angle"] = float64(f.GustAngle)
+			case netatmo.TypeRain:
+				fields["rain"] = f.Rain
+				fields["sum_rain_1"] = f.SumRain1
+				fields["sum_rain_24"] = f.SumRain24
+			case netatmo.TypeIndoor:
+				fields["temperature"] = f.Temperature
+				fields["humidity"] = f.Humidity
+				fields["co2"] = float64(f.CO2)
+			default:
+				fields["temperature"] = f.Temperature
+				fields["humidity"] = f.Humidity
+			}
+			lines = append(lines, influxLine{
+				Tags:   [][2]string{{"station", stationName}, {"module", f.ModuleName}, {"module_id", f.Id}, {"type", f.Type}},
+				Fields: fields,
+				Time:   f.TimeUtc,
+			})
+		}
+	}
+	return lines
+}
+
+// measureLines : Convert values of getmeasure to lines. Field names are the lower case of types.
+func measureLines(opt *netatmo.MeasureOptions, points []netatmo.MeasurePoint) []influxLine {
+	moduleID := opt.ModuleID
+	if moduleID == "" {
+		moduleID = opt.DeviceID
+	}
+	var lines []influxLine
+	for _, p := range points {
+		fields := map[string]float64{}
+		for i, t := range opt.Types {
+			if i < len(p.Values) && p.Values[i] != nil {
+				fields[strings.ToLower(t)] = *p.Values[i]
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		lines = append(lines, influxLine{
+			Tags:   [][2]string{{"device_id", opt.DeviceID}, {"module_id", moduleID}, {"scale", opt.Scale}},
+			Fields: fields,
+			Time:   p.Time,
+		})
+	}
+	return lines
+}
+
+// dispInflux : Display lines.
+func dispInflux(lines []influxLine) {
+	for _, l := range lines {
+		fmt.Println(l.String())
+	}
+}
+
+// influxWriter : Writer for the HTTP write endpoint of InfluxDB.
+type influxWriter struct {
+	URL   string // e.g. "http://localhost:8086/write?db=netatmo" or "http://localhost:8086/api/v2/write?org=###&bucket=###"
+	Token string
+	Batch int
+	Retry int
+}
+
+// post : Post a batch. Network errors, 429 and 5xx are retried with the exponential backoff.
+func (iw *influxWriter) post(body []byte) error {
+	headers := map[string]string{"Content-Type": "text/plain; charset=utf-8"}
+	if iw.Token != "" {
+		headers["Authorization"] = "Token " + iw.Token
+	}
+	return postWithRetry(nil, iw.URL, headers, body, iw.Retry, "InfluxDB")
+}
+
+// write : Write lines by each batch.
+func (iw *influxWriter) write(lines []influxLine) error {
+	batch := iw.Batch
+	if batch <= 0 {
+		batch = 5000
+	}
+	for i := 0; i < len(lines); i += batch {
+		end := i + batch
+		if end > len(lines) {
+			end = len(lines)
+		}
+		b := &bytes.Buffer{}
+		for _, l := range lines[i:end] {
+			b.WriteString(l.String() + "\n")
+		}
+		if err := iw.post(b.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushStations : Retrieve station data and write it as lines.
+func (m *materials) pushStations(iw *influxWriter) error {
+	sd, err := m.client.StationsData(nil)
+	if err != nil {
+		return err
+	}
+	lines := stationsLines(newStations(sd))
+	if iw == nil {
+		dispInflux(lines)
+		return nil
+	}
+	return iw.write(lines)
+}
+
+// push : Push station data as InfluxDB line protocol to stdout or the HTTP write endpoint.
+func (m *materials) push(c *cli.Context) {
+	var iw *influxWriter
+	if c.String("url") != "" {
+		iw = &influxWriter{
+			URL:   c.String("url"),
+			Token: c.String("token"),
+			Batch: c.Int("batch"),
+			Retry: c.Int("retry"),
+		}
+	}
+	if c.String("interval") == "" {
+		if err := m.pushStations(iw); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	interval, err := time.ParseDuration(c.String("interval"))
+	if err != nil || interval < time.Minute {
+		fmt.Printf("Error: Please input the interval of 1m or more. e.g. '10m'\n")
+		os.Exit(1)
+	}
+	for {
+		if err := m.refreshIfExpiring(5 * time.Minute); err != nil {
+			fmt.Fprintf(os.Stderr, "%s Error: %v\n", time.Now().Format(time.RFC3339), err)
+		} else if err := m.pushStations(iw); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %v\n", time.Now().Format(time.RFC3339), err)
+		}
+		time.Sleep(interval)
+	}
+}
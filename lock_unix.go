@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+// Package main (lock_unix.go) :
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile : Acquire the exclusive advisory lock of path by flock. The returned function releases it.
+func lockFile(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
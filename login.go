@@ -0,0 +1,186 @@
+// Package main (login.go) :
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/tanaikech/gonetatmo/netatmo"
+	"github.com/urfave/cli"
+	"golang.org/x/term"
+)
+
+const (
+	redirectURI = "http://localhost:8765/callback"
+)
+
+// authResult : Result of the callback.
+type authResult struct {
+	code string
+	err  error
+}
+
+// newState : Create a random state for preventing CSRF.
+func newState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// openBrowser : Open URL with the browser.
+func openBrowser(u string) error {
+	switch runtime.GOOS {
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", u).Start()
+	case "darwin":
+		return exec.Command("open", u).Start()
+	}
+	return exec.Command("xdg-open", u).Start()
+}
+
+// waitCode : Start the local server for redirect URI and wait for the authorization code.
+func waitCode(redirect *url.URL, state string, timeout time.Duration) (string, error) {
+	ln, err := net.Listen("tcp", redirect.Host)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Error: Couldn't start the local server at '%s'. %v", redirect.Host, err))
+	}
+	ch := make(chan authResult, 1)
+	mux := http.NewServeMux()
+	path := redirect.Path
+	if path == "" {
+		path = "/"
+	}
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var res authResult
+		switch {
+		case q.Get("state") != state:
+			res.err = errors.New("Error: State of the callback is not matched. Please run 'auth login' again.")
+		case q.Get("error") != "":
+			res.err = errors.New(fmt.Sprintf("Error: Authorization was not completed. %s", q.Get("error")))
+		case q.Get("code") == "":
+			res.err = errors.New("Error: No authorization code in the callback.")
+		default:
+			res.code = q.Get("code")
+		}
+		if res.err != nil {
+			http.Error(w, res.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintf(w, "%s was authorized. You can close this window.\n", appname)
+		}
+		select {
+		case ch <- res:
+		default:
+		}
+	})
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+	select {
+	case res := <-ch:
+		return res.code, res.err
+	case <-time.After(timeout):
+		return "", errors.New("Error: Timeout of waiting for the authorization.")
+	}
+}
+
+// login : Retrieve tokens by the authorization code flow. The password of Netatmo is not used.
+func (m *materials) login(c *cli.Context) {
+	if err := m.loadProfiles(); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	m.selectProfile(true)
+	if c.String("store") != "" {
+		s, err := newStore(c.String("store"), m.cfgPath())
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		m.store = s
+	}
+	var err error
+	if err = m.resolveCredentials(c); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	m.configFile.ClientId = m.clientID()
+	m.configFile.ClientSecret = m.clientSecret()
+	if m.configFile.ClientId == "" && term.IsTerminal(int(os.Stdin.Fd())) {
+		if m.configFile.ClientId, err = promptCredential("clientid"); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+	if m.configFile.ClientSecret == "" && term.IsTerminal(int(os.Stdin.Fd())) {
+		if m.configFile.ClientSecret, err = promptCredential("clientsecret"); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+	if c.String("scope") != "" {
+		scopes, err := parseScopes(c.String("scope"))
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		m.configFile.Scopes = scopes
+	}
+	if m.configFile.ClientId == "" || m.configFile.ClientSecret == "" {
+		fmt.Printf("Error: Please input client id and client secret.\n\n $ gonetatmo auth login --clientid ### --clientsecret ###\n\n")
+		os.Exit(1)
+	}
+	redirect, err := url.Parse(c.String("redirect"))
+	if err != nil || redirect.Scheme != "http" || redirect.Host == "" {
+		fmt.Printf("Error: Please input the redirect URI like '%s'. This is required to be registered to your application at https://dev.netatmo.com/\n", redirectURI)
+		os.Exit(1)
+	}
+	state, err := newState()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	authURL := netatmo.AuthorizeURL(m.configFile.ClientId, redirect.String(), m.scope(), state)
+	fmt.Printf("Please open the following URL and authorize %s.\n\n%s\n\n", appname, authURL)
+	if !c.Bool("noopen") {
+		openBrowser(authURL)
+	}
+	code, err := waitCode(redirect, state, c.Duration("timeout"))
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	tokenparams := url.Values{}
+	tokenparams.Set("grant_type", "authorization_code")
+	tokenparams.Set("client_id", m.configFile.ClientId)
+	tokenparams.Set("client_secret", m.configFile.ClientSecret)
+	tokenparams.Set("code", code)
+	tokenparams.Set("redirect_uri", redirect.String())
+	tokenparams.Set("scope", m.scope())
+	body, err := netatmo.GetTokens(tokenparams)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	m.getTokens(body)
+	if err := m.makecfgfile(); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+}
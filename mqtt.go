@@ -0,0 +1,301 @@
+// Package main (mqtt.go) :
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/tanaikech/gonetatmo/netatmo"
+	"github.com/urfave/cli"
+)
+
+// haSensor : Sensor for the discovery of Home Assistant.
+type haSensor struct {
+	Key         string // Key of the state payload.
+	Name        string
+	Unit        string
+	DeviceClass string
+}
+
+// haSensors : Sensors of each type of module.
+var haSensors = map[string][]haSensor{
+	netatmo.TypeMain: {
+		{"temperature", "Temperature", "°C", "temperature"},
+		{"humidity", "Humidity", "%", "humidity"},
+		{"co2", "CO2", "ppm", "carbon_dioxide"},
+		{"noise", "Noise", "dB", "sound_pressure"},
+		{"pressure", "Pressure", "hPa", "pressure"},
+		{"wifi_status", "Wifi status", "", ""},
+	},
+	netatmo.TypeOutdoor: {
+		{"temperature", "Temperature", "°C", "temperature"},
+		{"humidity", "Humidity", "%", "humidity"},
+		{"battery_percent", "Battery", "%", "battery"},
+		{"rf_status", "RF status", "", ""},
+	},
+	netatmo.TypeWind: {
+		{"wind_strength", "Wind strength", "km/h", "wind_speed"},
+		{"wind_angle", "Wind angle", "°", ""},
+		{"gust_strength", "Gust strength", "km/h", "wind_speed"},
+		{"gust_angle", "Gust angle", "°", ""},
+		{"battery_percent", "Battery", "%", "battery"},
+		{"rf_status", "RF status", "", ""},
+	},
+	netatmo.TypeRain: {
+		{"rain", "Rain", "mm", "precipitation"},
+		{"sum_rain_1", "Rain 1h", "mm", "precipitation"},
+		{"sum_rain_24", "Rain 24h", "mm", "precipitation"},
+		{"battery_percent", "Battery", "%", "battery"},
+		{"rf_status", "RF status", "", ""},
+	},
+	netatmo.TypeIndoor: {
+		{"temperature", "Temperature", "°C", "temperature"},
+		{"humidity", "Humidity", "%", "humidity"},
+		{"co2", "CO2", "ppm", "carbon_dioxide"},
+		{"battery_percent", "Battery", "%", "battery"},
+		{"rf_status", "RF status", "", ""},
+	},
+}
+
+// mqttModule : State of a module for publishing.
+type mqttModule struct {
+	ID          string
+	StationName string
+	Name        string
+	Type        string
+	ViaDevice   string
+	TimeUtc     int64
+	Values      map[string]interface{}
+}
+
+// mqttModules : Retrieve states of modules from stations data.
+func mqttModules(sd *netatmo.StationsData) []mqttModule {
+	var mms []mqttModule
+	for _, d := range sd.Body.Devices {
+		dd := d.DashboardData
+		mms = append(mms, mqttModule{
+			ID:          d.ID,
+			StationName: d.StationName,
+			Name:        d.ModuleName,
+			Type:        d.Type,
+			TimeUtc:     dd.TimeUtc,
+			Values: map[string]interface{}{
+				"temperature": dd.Temperature,
+				"humidity":    dd.Humidity,
+				"co2":         dd.CO2,
+				"noise":       dd.Noise,
+				"pressure":    dd.Pressure,
+				"wifi_status": d.WifiStatus,
+			},
+		})
+		for _, f := range d.Modules {
+			dd := f.DashboardData
+			mms = append(mms, mqttModule{
+				ID:          f.ID,
+				StationName: d.StationName,
+				Name:        f.ModuleName,
+				Type:        f.Type,
+				ViaDevice:   d.ID,
+				TimeUtc:     dd.TimeUtc,
+				Values: map[string]interface{}{
+					"temperature":     dd.Temperature,
+					"humidity":        dd.Humidity,
+					"co2":             dd.CO2,
+					"wind_strength":   dd.WindStrength,
+					"wind_angle":      dd.WindAngle,
+					"gust_strength":   dd.GustStrength,
+					"gust_angle":      dd.GustAngle,
+					"rain":            dd.Rain,
+					"sum_rain_1":      dd.SumRain1,
+					"sum_rain_24":     dd.SumRain24,
+					"battery_percent": f.BatteryPercent,
+					"rf_status":       f.RfStatus,
+				},
+			})
+		}
+	}
+	return mms
+}
+
+// mqttPublisher : Publisher of station data to MQTT.
+type mqttPublisher struct {
+	client          paho.Client
+	prefix          string
+	discoveryPrefix string
+	retain          bool
+	mu              sync.Mutex
+	modules         map[string]mqttModule // Modules whose discovery configs were published.
+}
+
+// topicID : Convert the mac address to a string for topics.
+func topicID(id string) string {
+	return strings.NewReplacer(":", "", "/", "_", "+", "_", "#", "_").Replace(strings.ToLower(id))
+}
+
+// publish : Publish payload and wait for the completion.
+func (mp *mqttPublisher) publish(topic string, retain bool, payload interface{}) error {
+	var b []byte
+	switch p := payload.(type) {
+	case string:
+		b = []byte(p)
+	default:
+		var err error
+		if b, err = json.Marshal(p); err != nil {
+			return err
+		}
+	}
+	t := mp.client.Publish(topic, 1, retain, b)
+	if !t.WaitTimeout(30 * time.Second) {
+		return errors.New(fmt.Sprintf("Error: Timeout of publishing to '%s'.", topic))
+	}
+	return t.Error()
+}
+
+// discovery : Publish the discovery configs of Home Assistant for module.
+func (mp *mqttPublisher) discovery(mm mqttModule) error {
+	id := topicID(mm.ID)
+	device := map[string]interface{}{
+		"identifiers":  []string{mm.ID},
+		"name":         strings.TrimSpace(mm.StationName + " " + mm.Name),
+		"manufacturer": "Netatmo",
+		"model":        mm.Type,
+	}
+	if mm.ViaDevice != "" {
+		device["via_device"] = mm.ViaDevice
+	}
+	for _, s := range haSensors[mm.Type] {
+		cfg := map[string]interface{}{
+			"name":           s.Name,
+			"unique_id":      "gonetatmo_" + id + "_" + s.Key,
+			"object_id":      topicID(mm.Name) + "_" + s.Key,
+			"state_topic":    mp.prefix + "/" + id + "/state",
+			"value_template": "{{ value_json." + s.Key + " }}",
+			"availability": []map[string]string{
+				{"topic": mp.prefix + "/status"},
+				{"topic": mp.prefix + "/" + id + "/availability"},
+			},
+			"availability_mode": "all",
+			"device":            device,
+		}
+		if s.Unit != "" {
+			cfg["unit_of_measurement"] = s.Unit
+			cfg["state_class"] = "measurement"
+		}
+		if s.DeviceClass != "" {
+			cfg["device_class"] = s.DeviceClass
+		}
+		if err := mp.publish(mp.discoveryPrefix+"/sensor/gonetatmo_"+id+"/"+s.Key+"/config", true, cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// state : Publish the state and the availability of module. The module is unavailable when the measurement is older than mestimeThreshold.
+func (mp *mqttPublisher) state(mm mqttModule) error {
+	id := topicID(mm.ID)
+	availability := "online"
+	if time.Now().Unix()-mm.TimeUtc > mestimeThreshold {
+		availability = "offline"
+	}
+	if err := mp.publish(mp.prefix+"/"+id+"/availability", true, availability); err != nil {
+		return err
+	}
+	if availability == "offline" {
+		return nil
+	}
+	values := map[string]interface{}{"time_utc": mm.TimeUtc}
+	for _, s := range haSensors[mm.Type] {
+		values[s.Key] = mm.Values[s.Key]
+	}
+	return mp.publish(mp.prefix+"/"+id+"/state", mp.retain, values)
+}
+
+// onConnect : Publish "online" and the discovery configs again at every connection. The broker publishes
+// the will of "offline" when the connection is lost, so the sensors are unavailable until this is published.
+func (mp *mqttPublisher) onConnect(paho.Client) {
+	if err := mp.publish(mp.prefix+"/status", true, "online"); err != nil {
+		logf("%v", err)
+		return
+	}
+	mp.mu.Lock()
+	modules := make([]mqttModule, 0, len(mp.modules))
+	for _, mm := range mp.modules {
+		modules = append(modules, mm)
+	}
+	mp.mu.Unlock()
+	for _, mm := range modules {
+		if err := mp.discovery(mm); err != nil {
+			logf("%v", err)
+			return
+		}
+	}
+}
+
+// publishStations : Retrieve station data and publish it.
+func (m *materials) publishStations(mp *mqttPublisher) error {
+	sd, err := m.client.StationsData(nil)
+	if err != nil {
+		return err
+	}
+	for _, mm := range mqttModules(sd) {
+		mp.mu.Lock()
+		_, ok := mp.modules[mm.ID]
+		mp.mu.Unlock()
+		if !ok {
+			if err := mp.discovery(mm); err != nil {
+				return err
+			}
+			mp.mu.Lock()
+			mp.modules[mm.ID] = mm
+			mp.mu.Unlock()
+		}
+		if err := mp.state(mm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mqtt : Publish station data to MQTT every interval with the discovery of Home Assistant.
+func (m *materials) mqtt(c *cli.Context) {
+	interval, err := time.ParseDuration(c.String("interval"))
+	if err != nil || interval < time.Minute {
+		fmt.Printf("Error: Please input the interval of 1m or more. e.g. '10m'\n")
+		os.Exit(1)
+	}
+	mp := &mqttPublisher{
+		prefix:          strings.TrimSuffix(c.String("topicprefix"), "/"),
+		discoveryPrefix: strings.TrimSuffix(c.String("discoveryprefix"), "/"),
+		retain:          c.Bool("retain"),
+		modules:         map[string]mqttModule{},
+	}
+	opts := paho.NewClientOptions().
+		AddBroker(c.String("broker")).
+		SetClientID(c.String("mqttclientid")).
+		SetUsername(c.String("mqttuser")).
+		SetPassword(c.String("mqttpassword")).
+		SetAutoReconnect(true).
+		SetWill(mp.prefix+"/status", "offline", 1, true).
+		SetOnConnectHandler(mp.onConnect)
+	mp.client = paho.NewClient(opts)
+	if t := mp.client.Connect(); t.Wait() && t.Error() != nil {
+		fmt.Printf("Error: %v\n", t.Error())
+		os.Exit(1)
+	}
+	defer mp.client.Disconnect(1000)
+	for {
+		if err := m.refreshIfExpiring(5 * time.Minute); err != nil {
+			fmt.Fprintf(os.Stderr, "%s Error: %v\n", time.Now().Format(time.RFC3339), err)
+		} else if err := m.publishStations(mp); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %v\n", time.Now().Format(time.RFC3339), err)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,229 @@
+// Package netatmo (client.go) :
+package netatmo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TokenSource : Source of the access token used for each request.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// Refresher : TokenSource which can retrieve new access token. When Netatmo rejects the access token as invalid or expired,
+// Client calls Refresh once, and the request is sent again with the new access token returned by Token.
+type Refresher interface {
+	Refresh() error
+}
+
+// StaticToken : TokenSource which always returns the same access token.
+type StaticToken string
+
+// Token : Return the access token.
+func (s StaticToken) Token() (string, error) {
+	return string(s), nil
+}
+
+// Client : Client for Netatmo APIs.
+type Client struct {
+	BaseURL    string       // Default is "https://api.netatmo.com/".
+	HTTPClient *http.Client // When this is nil, a client with the timeout of 60 seconds is used.
+	Tokens     TokenSource
+}
+
+// NewClient : Create a client using the default base URL.
+func NewClient(ts TokenSource) *Client {
+	return &Client{
+		BaseURL: netatmoApi,
+		Tokens:  ts,
+	}
+}
+
+// StationsDataOptions : Options for getstationsdata.
+type StationsDataOptions struct {
+	DeviceID     string
+	GetFavorites bool
+}
+
+// MeasureOptions : Options for getmeasure.
+type MeasureOptions struct {
+	DeviceID   string
+	ModuleID   string
+	Scale      string // 30min, 1hour, 3hours, 1day, 1week, 1month or max.
+	Types      []string
+	DateBegin  time.Time
+	DateEnd    time.Time
+	Limit      int // Max is 1024.
+	RealTime   bool
+	NoOptimize bool // When this is true, the values are returned as the keyed form of "optimize=false".
+}
+
+// PublicDataOptions : Options for getpublicdata.
+type PublicDataOptions struct {
+	LatNE        float64
+	LonNE        float64
+	LatSW        float64
+	LonSW        float64
+	RequiredData string
+	Filter       bool
+}
+
+// NewPublicDataOptions : Create options from the coordinates returned by GetCoordinates.
+func NewPublicDataOptions(coordinates []float64) *PublicDataOptions {
+	return &PublicDataOptions{
+		LatNE: coordinates[0],
+		LonNE: coordinates[1],
+		LatSW: coordinates[2],
+		LonSW: coordinates[3],
+	}
+}
+
+// call : Call Netatmo's API of endpoint with params. When the access token is rejected and Tokens is Refresher,
+// the access token is refreshed and the request is sent again only once.
+func (c *Client) call(endpoint string, params url.Values) ([]byte, error) {
+	body, err := c.send(endpoint, params)
+	if IsInvalidToken(err) {
+		if r, ok := c.Tokens.(Refresher); ok {
+			if err := r.Refresh(); err != nil {
+				return nil, err
+			}
+			return c.send(endpoint, params)
+		}
+	}
+	return body, err
+}
+
+// send : Send the request to endpoint with the current access token.
+func (c *Client) send(endpoint string, params url.Values) ([]byte, error) {
+	if c.Tokens == nil {
+		return nil, errors.New("Error: No token source is set to the client.")
+	}
+	accesstoken, err := c.Tokens.Token()
+	if err != nil {
+		return nil, err
+	}
+	params.Set("access_token", accesstoken)
+	base := c.BaseURL
+	if base == "" {
+		base = netatmoApi
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return callNetatmoApis(c.HTTPClient, base+"api/"+endpoint+"?"+params.Encode())
+}
+
+// decode : Decode body to v.
+func decode(body []byte, v interface{}) error {
+	if err := json.Unmarshal(body, v); err != nil {
+		return errors.New(fmt.Sprintf("Error: Unexpected response from Netatmo. %v", err))
+	}
+	return nil
+}
+
+// StationsDataRaw : Retrieve the raw response of getstationsdata.
+func (c *Client) StationsDataRaw(opt *StationsDataOptions) ([]byte, error) {
+	params := url.Values{}
+	if opt != nil {
+		if opt.DeviceID != "" {
+			params.Set("device_id", opt.DeviceID)
+		}
+		if opt.GetFavorites {
+			params.Set("get_favorites", "true")
+		}
+	}
+	return c.call("getstationsdata", params)
+}
+
+// StationsData : https://dev.netatmo.com/resources/technical/reference/weatherstation/getstationsdata
+func (c *Client) StationsData(opt *StationsDataOptions) (*StationsData, error) {
+	body, err := c.StationsDataRaw(opt)
+	if err != nil {
+		return nil, err
+	}
+	sd := &StationsData{}
+	if err := decode(body, sd); err != nil {
+		return nil, err
+	}
+	return sd, nil
+}
+
+// MeasureRaw : Retrieve the raw response of getmeasure.
+func (c *Client) MeasureRaw(opt *MeasureOptions) ([]byte, error) {
+	if opt == nil || opt.DeviceID == "" {
+		return nil, errors.New("Error: Device ID is required for getmeasure.")
+	}
+	params := url.Values{}
+	params.Set("device_id", opt.DeviceID)
+	if opt.ModuleID != "" {
+		params.Set("module_id", opt.ModuleID)
+	}
+	params.Set("scale", opt.Scale)
+	params.Set("type", strings.Join(opt.Types, ","))
+	if !opt.DateBegin.IsZero() {
+		params.Set("date_begin", strconv.FormatInt(opt.DateBegin.Unix(), 10))
+	}
+	if !opt.DateEnd.IsZero() {
+		params.Set("date_end", strconv.FormatInt(opt.DateEnd.Unix(), 10))
+	}
+	if opt.Limit > 0 {
+		params.Set("limit", strconv.Itoa(opt.Limit))
+	}
+	params.Set("real_time", strconv.FormatBool(opt.RealTime))
+	if opt.NoOptimize {
+		params.Set("optimize", "false")
+	}
+	return c.call("getmeasure", params)
+}
+
+// Measure : https://dev.netatmo.com/resources/technical/reference/common/getmeasure
+func (c *Client) Measure(opt *MeasureOptions) (*Measure, error) {
+	body, err := c.MeasureRaw(opt)
+	if err != nil {
+		return nil, err
+	}
+	me := &Measure{}
+	if err := decode(body, me); err != nil {
+		return nil, err
+	}
+	return me, nil
+}
+
+// PublicDataRaw : Retrieve the raw response of getpublicdata.
+func (c *Client) PublicDataRaw(opt *PublicDataOptions) ([]byte, error) {
+	if opt == nil {
+		return nil, errors.New("Error: Coordinates are required for getpublicdata.")
+	}
+	params := url.Values{}
+	params.Set("lat_ne", strconv.FormatFloat(opt.LatNE, 'f', 15, 64))
+	params.Set("lon_ne", strconv.FormatFloat(opt.LonNE, 'f', 15, 64))
+	params.Set("lat_sw", strconv.FormatFloat(opt.LatSW, 'f', 15, 64))
+	params.Set("lon_sw", strconv.FormatFloat(opt.LonSW, 'f', 15, 64))
+	if opt.RequiredData != "" {
+		params.Set("required_data", opt.RequiredData)
+	}
+	if opt.Filter {
+		params.Set("filter", "true")
+	}
+	return c.call("getpublicdata", params)
+}
+
+// PublicData : https://dev.netatmo.com/en-US/resources/technical/reference/weatherapi/getpublicdata
+func (c *Client) PublicData(opt *PublicDataOptions) (*PublicData, error) {
+	body, err := c.PublicDataRaw(opt)
+	if err != nil {
+		return nil, err
+	}
+	pd := &PublicData{}
+	if err := decode(body, pd); err != nil {
+		return nil, err
+	}
+	return pd, nil
+}
@@ -0,0 +1,101 @@
+// Package netatmo (errors.go) :
+package netatmo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Error codes of Netatmo. https://dev.netatmo.com/apidocumentation/general#status-ok
+const (
+	CodeAccessTokenMissing = 1
+	CodeInvalidAccessToken = 2
+	CodeAccessTokenExpired = 3
+	CodeDeviceNotFound     = 9
+	CodeMissingArgs        = 10
+	CodeOperationForbidden = 13
+	CodeInvalidArg         = 21
+	CodeMaxUsageReached    = 26
+)
+
+// APIError : Error response of Netatmo's APIs. The error of OAuth like "invalid_grant" has Code of 0 and OAuthError.
+type APIError struct {
+	StatusCode int    // HTTP status code.
+	Code       int    // Error code of Netatmo.
+	OAuthError string // Error of OAuth for "oauth2/token".
+	Message    string
+}
+
+// Error : Return the message including the status code and the error code.
+func (e *APIError) Error() string {
+	switch {
+	case e.OAuthError != "":
+		return fmt.Sprintf("Error: Netatmo returned '%s' (HTTP %d). %s", e.OAuthError, e.StatusCode, e.Message)
+	case e.Code != 0:
+		return fmt.Sprintf("Error: Netatmo returned the error code %d (HTTP %d). %s", e.Code, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("Error: Netatmo returned HTTP %d. %s", e.StatusCode, e.Message)
+}
+
+// parseAPIError : Retrieve APIError from the response. When the response is not an error, nil is returned.
+// The error of APIs is {"error": {"code": 2, "message": "..."}} and the error of OAuth is {"error": "invalid_grant"}.
+func parseAPIError(status int, body []byte) *APIError {
+	var r struct {
+		Error            json.RawMessage `json:"error"`
+		ErrorDescription string          `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil || len(r.Error) == 0 {
+		if status < 400 {
+			return nil
+		}
+		msg := strings.TrimSpace(string(body))
+		if msg == "" {
+			msg = http.StatusText(status)
+		}
+		return &APIError{StatusCode: status, Message: msg}
+	}
+	e := &APIError{StatusCode: status}
+	var apiErr struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(r.Error, &e.OAuthError) == nil {
+		e.Message = r.ErrorDescription
+	} else if json.Unmarshal(r.Error, &apiErr) == nil {
+		e.Code = apiErr.Code
+		e.Message = apiErr.Message
+	} else {
+		e.Message = string(r.Error)
+	}
+	return e
+}
+
+// asAPIError : Retrieve APIError from err.
+func asAPIError(err error) (*APIError, bool) {
+	var e *APIError
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// IsInvalidToken : Check whether err is the invalid or expired access token, or the invalid refresh token of OAuth.
+func IsInvalidToken(err error) bool {
+	e, ok := asAPIError(err)
+	return ok && (e.Code == CodeInvalidAccessToken || e.Code == CodeAccessTokenExpired || e.OAuthError == "invalid_grant")
+}
+
+// IsRateLimited : Check whether err is the limit of requests. Netatmo returns HTTP 429 or the error code 26.
+func IsRateLimited(err error) bool {
+	e, ok := asAPIError(err)
+	return ok && (e.StatusCode == http.StatusTooManyRequests || e.Code == CodeMaxUsageReached)
+}
+
+// IsDeviceNotFound : Check whether err is the device or the module which is not found.
+func IsDeviceNotFound(err error) bool {
+	e, ok := asAPIError(err)
+	return ok && e.Code == CodeDeviceNotFound
+}
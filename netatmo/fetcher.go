@@ -2,7 +2,9 @@
 package netatmo
 
 import (
+	"bytes"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"time"
 )
@@ -15,19 +17,60 @@ type RequestParams struct {
 	Contenttype string
 	Accesstoken string
 	Dtime       int64
+	Client      *http.Client
+	Limiter     *Limiter // When this is nil, the request is not limited and not retried.
 }
 
 // fetch : Fetch data from Google Drive
 func (r *RequestParams) fetch() (*http.Response, error) {
-	req, err := http.NewRequest(r.Method, r.APIURL, r.Data)
-	if err != nil {
-		return nil, err
+	var data []byte
+	if r.Data != nil {
+		b, err := ioutil.ReadAll(r.Data)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	}
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: time.Duration(r.Dtime) * time.Second}
+	}
+	for i := 0; ; i++ {
+		if r.Limiter != nil {
+			r.Limiter.Wait()
+		}
+		req, err := http.NewRequest(r.Method, r.APIURL, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", r.Contenttype)
+		res, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if r.Limiter == nil || i >= r.Limiter.Retry || !r.retryable(res) {
+			return res, nil
+		}
+		wait := r.Limiter.backoff(res, i)
+		if wait > r.Limiter.MaxWait {
+			return res, nil
+		}
+		res.Body.Close()
+		time.Sleep(wait)
+	}
+}
+
+// retryable : Check whether the response is the limit of requests or 503. Netatmo returns 429 or 403 with the error code 26
+// for the limit. The body is read for checking the error code, and it is replaced so that it can be read again.
+func (r *RequestParams) retryable(res *http.Response) bool {
+	if res.StatusCode < 400 {
+		return false
 	}
-	req.Header.Set("Content-Type", r.Contenttype)
-	client := &http.Client{Timeout: time.Duration(r.Dtime) * time.Second}
-	res, err := client.Do(req)
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
 	if err != nil {
-		return nil, err
+		return false
 	}
-	return res, nil
+	return res.StatusCode == http.StatusServiceUnavailable || IsRateLimited(parseAPIError(res.StatusCode, body))
 }
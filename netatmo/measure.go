@@ -0,0 +1,144 @@
+// Package netatmo (measure.go) :
+package netatmo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	maxMeasureLimit = 1024 // Max number of values per request of getmeasure.
+)
+
+// MeasurePoint : Values at a timestamp. Values has the order of the requested types.
+type MeasurePoint struct {
+	Time   int64
+	Values []*float64
+}
+
+// UnmarshalJSON : Decode both forms of "optimize=true" and "optimize=false".
+func (b *MeasureBody) UnmarshalJSON(data []byte) error {
+	var blocks []MeasureBlock
+	if err := json.Unmarshal(data, &blocks); err == nil {
+		b.Blocks = blocks
+		return nil
+	}
+	var values map[string][]*float64
+	if err := json.Unmarshal(data, &values); err != nil {
+		return errors.New(fmt.Sprintf("Error: Unexpected body of getmeasure. %v", err))
+	}
+	b.Values = values
+	return nil
+}
+
+// MarshalJSON : Encode to the same form as the response.
+func (b MeasureBody) MarshalJSON() ([]byte, error) {
+	if b.Values != nil {
+		return json.Marshal(b.Values)
+	}
+	return json.Marshal(b.Blocks)
+}
+
+// Points : Retrieve values of all timestamps sorted by time.
+func (m *Measure) Points() ([]MeasurePoint, error) {
+	var points []MeasurePoint
+	for _, e := range m.Body.Blocks {
+		for i, v := range e.Value {
+			points = append(points, MeasurePoint{Time: e.BegTime + int64(i)*e.StepTime, Values: v})
+		}
+	}
+	for k, v := range m.Body.Values {
+		t, err := strconv.ParseInt(k, 10, 64)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Error: Unexpected timestamp of getmeasure. %v", err))
+		}
+		points = append(points, MeasurePoint{Time: t, Values: v})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Time < points[j].Time })
+	return points, nil
+}
+
+// MeasurePages : Retrieve all values from DateBegin to DateEnd over the limit of 1024 values per request.
+// Requests are repeated from the next second of the last returned timestamp, and page is called with the values
+// of each request sorted by time. The values at the boundary of pages can be given twice. When page returns an error,
+// the requests are stopped and the error is returned.
+func (c *Client) MeasurePages(opt *MeasureOptions, page func(points []MeasurePoint) error) error {
+	if opt == nil {
+		return errors.New("Error: Device ID is required for getmeasure.")
+	}
+	o := *opt
+	if o.DateEnd.IsZero() {
+		o.DateEnd = time.Now()
+	}
+	limit := o.Limit
+	if limit <= 0 || limit > maxMeasureLimit {
+		limit = maxMeasureLimit
+	}
+	o.Limit = limit
+	for {
+		me, err := c.Measure(&o)
+		if err != nil {
+			return err
+		}
+		points, err := me.Points()
+		if err != nil {
+			return err
+		}
+		if len(points) == 0 {
+			return nil
+		}
+		if err := page(points); err != nil {
+			return err
+		}
+		last := points[len(points)-1].Time
+		if len(points) < limit || last >= o.DateEnd.Unix() || (!o.DateBegin.IsZero() && last < o.DateBegin.Unix()) {
+			return nil
+		}
+		o.DateBegin = time.Unix(last+1, 0)
+	}
+}
+
+// MeasureAll : Retrieve all values from DateBegin to DateEnd by MeasurePages. When progress is not nil,
+// it is called with the number of retrieved values and the last timestamp after each request.
+func (c *Client) MeasureAll(opt *MeasureOptions, progress func(n int, last time.Time)) ([]MeasurePoint, error) {
+	merged := map[int64]MeasurePoint{}
+	err := c.MeasurePages(opt, func(points []MeasurePoint) error {
+		for _, p := range points {
+			merged[p.Time] = p
+		}
+		if progress != nil {
+			progress(len(merged), time.Unix(points[len(points)-1].Time, 0))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]MeasurePoint, 0, len(merged))
+	for _, p := range merged {
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Time < res[j].Time })
+	return res, nil
+}
+
+// MeasureTypes : Types of getmeasure which can be retrieved from the type of module.
+func MeasureTypes(moduleType string) []string {
+	switch moduleType {
+	case TypeMain:
+		return []string{"Temperature", "CO2", "Humidity", "Noise", "Pressure"}
+	case TypeOutdoor:
+		return []string{"Temperature", "Humidity"}
+	case TypeWind:
+		return []string{"WindStrength", "WindAngle", "GustStrength", "GustAngle"}
+	case TypeRain:
+		return []string{"Rain"}
+	case TypeIndoor:
+		return []string{"Temperature", "CO2", "Humidity"}
+	}
+	return nil
+}
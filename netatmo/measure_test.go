@@ -0,0 +1,95 @@
+package netatmo
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// measureServer : Fake getmeasure returning n values every 300 seconds from start. When overlap is true,
+// each response starts from the value before date_begin like the boundary of pages of Netatmo.
+func measureServer(t *testing.T, start int64, n int, overlap bool, calls *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		if *calls > 10 {
+			t.Errorf("too many requests. MeasureAll may loop forever.")
+			http.Error(w, `{"error":{"code":26,"message":"too many requests"}}`, http.StatusForbidden)
+			return
+		}
+		q := r.URL.Query()
+		begin, _ := strconv.ParseInt(q.Get("date_begin"), 10, 64)
+		end, _ := strconv.ParseInt(q.Get("date_end"), 10, 64)
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		var first int64 = -1
+		var values []string
+		for i := 0; i < n && len(values) < limit; i++ {
+			ts := start + int64(i)*300
+			if ts > end {
+				break
+			}
+			if ts < begin && !(overlap && ts+300 >= begin) {
+				continue
+			}
+			if first < 0 {
+				first = ts
+			}
+			values = append(values, fmt.Sprintf("[%d]", i))
+		}
+		if len(values) == 0 {
+			fmt.Fprint(w, `{"body":[],"status":"ok"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"body":[{"beg_time":%d,"step_time":300,"value":[%s]}],"status":"ok"}`, first, strings.Join(values, ","))
+	}))
+}
+
+func TestMeasureAll(t *testing.T) {
+	start := int64(1600000200)
+	tests := []struct {
+		name    string
+		n       int
+		overlap bool
+		calls   int
+	}{
+		{"partial page", 10, false, 1},
+		{"full pages and empty last page", 2 * maxMeasureLimit, false, 3},
+		{"overlapping timestamps at page boundaries", maxMeasureLimit + 500, true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			srv := measureServer(t, start, tt.n, tt.overlap, &calls)
+			defer srv.Close()
+			c := &Client{BaseURL: srv.URL, Tokens: StaticToken("token")}
+			opt := &MeasureOptions{
+				DeviceID:  "70:ee:50:00:00:00",
+				Types:     []string{"Temperature"},
+				DateBegin: time.Unix(start, 0),
+				DateEnd:   time.Unix(start+int64(tt.n+100)*300, 0),
+			}
+			pages := 0
+			points, err := c.MeasureAll(opt, func(n int, last time.Time) { pages++ })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if calls != tt.calls {
+				t.Errorf("requests = %d, want %d", calls, tt.calls)
+			}
+			if len(points) != tt.n {
+				t.Fatalf("values = %d, want %d", len(points), tt.n)
+			}
+			for i, p := range points {
+				if p.Time != start+int64(i)*300 || *p.Values[0] != float64(i) {
+					t.Fatalf("value %d is %d %v. Values are lost or duplicated.", i, p.Time, *p.Values[0])
+				}
+			}
+			if pages == 0 {
+				t.Error("progress was not called")
+			}
+		})
+	}
+}
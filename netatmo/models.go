@@ -0,0 +1,180 @@
+// Package netatmo (models.go) :
+package netatmo
+
+// Types of modules.
+const (
+	TypeMain    = "NAMain"    // Indoor base station.
+	TypeOutdoor = "NAModule1" // Outdoor module.
+	TypeWind    = "NAModule2" // Wind gauge.
+	TypeRain    = "NAModule3" // Rain gauge.
+	TypeIndoor  = "NAModule4" // Additional indoor module.
+)
+
+// StationsData : Response of getstationsdata.
+type StationsData struct {
+	Body       StationsDataBody `json:"body"`
+	Status     string           `json:"status"`
+	TimeExec   float64          `json:"time_exec"`
+	TimeServer int64            `json:"time_server"`
+}
+
+// StationsDataBody : Body of getstationsdata.
+type StationsDataBody struct {
+	Devices []Device `json:"devices"`
+	User    User     `json:"user"`
+}
+
+// User : User of the stations.
+type User struct {
+	Mail           string         `json:"mail"`
+	Administrative Administrative `json:"administrative"`
+}
+
+// Administrative : Administrative settings of the user.
+type Administrative struct {
+	Country      string `json:"country"`
+	RegLocale    string `json:"reg_locale"`
+	Lang         string `json:"lang"`
+	Unit         int    `json:"unit"`         // 0: metric, 1: imperial
+	WindUnit     int    `json:"windunit"`     // 0: kph, 1: mph, 2: ms, 3: beaufort, 4: knot
+	PressureUnit int    `json:"pressureunit"` // 0: mbar, 1: inHg, 2: mmHg
+	FeelLikeAlgo int    `json:"feel_like_algo"`
+}
+
+// Place : Location of the station.
+type Place struct {
+	Altitude float64   `json:"altitude"`
+	City     string    `json:"city"`
+	Country  string    `json:"country"`
+	Timezone string    `json:"timezone"`
+	Location []float64 `json:"location"` // [0]longitude, [1]latitude
+}
+
+// Device : Main module (NAMain) of a weather station.
+type Device struct {
+	ID              string        `json:"_id"`
+	CipherID        string        `json:"cipher_id"`
+	Type            string        `json:"type"`
+	StationName     string        `json:"station_name"`
+	ModuleName      string        `json:"module_name"`
+	HomeID          string        `json:"home_id"`
+	HomeName        string        `json:"home_name"`
+	DateSetup       int64         `json:"date_setup"`
+	LastSetup       int64         `json:"last_setup"`
+	LastStatusStore int64         `json:"last_status_store"`
+	LastUpgrade     int64         `json:"last_upgrade"`
+	Firmware        int           `json:"firmware"`
+	WifiStatus      int           `json:"wifi_status"`
+	Reachable       bool          `json:"reachable"`
+	CO2Calibrating  bool          `json:"co2_calibrating"`
+	ReadOnly        bool          `json:"read_only"`
+	DataType        []string      `json:"data_type"`
+	Place           Place         `json:"place"`
+	DashboardData   DashboardData `json:"dashboard_data"`
+	Modules         []Module      `json:"modules"`
+}
+
+// Module : Module (NAModule1, NAModule2, NAModule3 or NAModule4) connected to the main module.
+type Module struct {
+	ID             string        `json:"_id"`
+	Type           string        `json:"type"`
+	ModuleName     string        `json:"module_name"`
+	LastSetup      int64         `json:"last_setup"`
+	LastMessage    int64         `json:"last_message"`
+	LastSeen       int64         `json:"last_seen"`
+	Firmware       int           `json:"firmware"`
+	RfStatus       int           `json:"rf_status"`
+	BatteryVp      int           `json:"battery_vp"`
+	BatteryPercent int           `json:"battery_percent"`
+	Reachable      bool          `json:"reachable"`
+	DataType       []string      `json:"data_type"`
+	DashboardData  DashboardData `json:"dashboard_data"`
+}
+
+// DashboardData : Last values of a module. Which fields are set depends on the type of module.
+type DashboardData struct {
+	TimeUtc          int64   `json:"time_utc"`
+	Temperature      float64 `json:"Temperature"`
+	MinTemp          float64 `json:"min_temp"`
+	MaxTemp          float64 `json:"max_temp"`
+	DateMinTemp      int64   `json:"date_min_temp"`
+	DateMaxTemp      int64   `json:"date_max_temp"`
+	TempTrend        string  `json:"temp_trend"`
+	Humidity         float64 `json:"Humidity"`
+	CO2              int     `json:"CO2"`
+	Noise            int     `json:"Noise"`
+	Pressure         float64 `json:"Pressure"`
+	AbsolutePressure float64 `json:"AbsolutePressure"`
+	PressureTrend    string  `json:"pressure_trend"`
+	WindStrength     int     `json:"WindStrength"`
+	WindAngle        int     `json:"WindAngle"`
+	GustStrength     int     `json:"GustStrength"`
+	GustAngle        int     `json:"GustAngle"`
+	MaxWindStr       int     `json:"max_wind_str"`
+	MaxWindAngle     int     `json:"max_wind_angle"`
+	DateMaxWindStr   int64   `json:"date_max_wind_str"`
+	Rain             float64 `json:"Rain"`
+	SumRain1         float64 `json:"sum_rain_1"`
+	SumRain24        float64 `json:"sum_rain_24"`
+}
+
+// Measure : Response of getmeasure.
+type Measure struct {
+	Body       MeasureBody `json:"body"`
+	Status     string      `json:"status"`
+	TimeExec   float64     `json:"time_exec"`
+	TimeServer int64       `json:"time_server"`
+}
+
+// MeasureBody : Body of getmeasure. Blocks is used for "optimize=true" and Values is used for "optimize=false".
+type MeasureBody struct {
+	Blocks []MeasureBlock
+	Values map[string][]*float64 // Key is the timestamp.
+}
+
+// MeasureBlock : Values measured every step_time from beg_time. Each value has the order of the requested types.
+type MeasureBlock struct {
+	BegTime  int64        `json:"beg_time"`
+	StepTime int64        `json:"step_time"`
+	Value    [][]*float64 `json:"value"`
+}
+
+// PublicData : Response of getpublicdata.
+type PublicData struct {
+	Body       []PublicStation `json:"body"`
+	Status     string          `json:"status"`
+	TimeExec   float64         `json:"time_exec"`
+	TimeServer int64           `json:"time_server"`
+}
+
+// PublicStation : Station returned by getpublicdata.
+type PublicStation struct {
+	ID    string `json:"_id"`
+	Place struct {
+		Location []float64 `json:"location"` // [0]longitude, [1]latitude
+		Altitude float64   `json:"altitude"`
+		Timezone string    `json:"timezone"`
+		Country  string    `json:"country"`
+		City     string    `json:"city"`
+		Street   string    `json:"street"`
+	} `json:"place"`
+	Mark        int                      `json:"mark"`
+	Measures    map[string]PublicMeasure `json:"measures"`
+	Modules     []string                 `json:"modules"`
+	ModuleTypes map[string]string        `json:"module_types"`
+}
+
+// PublicMeasure : Measures of a module of a public station.
+type PublicMeasure struct {
+	Res          map[string][]*float64 `json:"res,omitempty"` // Key is the timestamp.
+	Type         []string              `json:"type,omitempty"`
+	Rain60min    *float64              `json:"rain_60min,omitempty"`
+	Rain24h      *float64              `json:"rain_24h,omitempty"`
+	RainLive     *float64              `json:"rain_live,omitempty"`
+	RainTimeUtc  *int64                `json:"rain_timeutc,omitempty"`
+	WindStrength *float64              `json:"wind_strength,omitempty"`
+	WindAngle    *float64              `json:"wind_angle,omitempty"`
+	GustStrength *float64              `json:"gust_strength,omitempty"`
+	GustAngle    *float64              `json:"gust_angle,omitempty"`
+	WindTimeUtc  *int64                `json:"wind_timeutc,omitempty"`
+}
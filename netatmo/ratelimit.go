@@ -0,0 +1,140 @@
+// Package netatmo (ratelimit.go) :
+package netatmo
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit : Limit of N requests in Per.
+type RateLimit struct {
+	N   int
+	Per time.Duration
+}
+
+// String : Return the limit like "50/10s".
+func (r RateLimit) String() string {
+	return fmt.Sprintf("%d/%v", r.N, r.Per)
+}
+
+// DefaultRateLimits : Limits of requests per user of Netatmo. 50 requests per 10 seconds and 500 requests per hour.
+var DefaultRateLimits = []RateLimit{{N: 50, Per: 10 * time.Second}, {N: 500, Per: time.Hour}}
+
+// ParseRateLimits : Parse limits separated by "," like "50/10s,500/1h". "off" means no limit.
+func ParseRateLimits(s string) ([]RateLimit, error) {
+	s = strings.TrimSpace(s)
+	if s == "off" {
+		return []RateLimit{}, nil
+	}
+	var res []RateLimit
+	for _, e := range strings.Split(s, ",") {
+		p := strings.SplitN(strings.TrimSpace(e), "/", 2)
+		if len(p) != 2 {
+			return nil, errors.New(fmt.Sprintf("Error: Wrong rate limit '%s'. Please use the format like '50/10s,500/1h'.", e))
+		}
+		n, err := strconv.Atoi(p[0])
+		if err != nil || n <= 0 {
+			return nil, errors.New(fmt.Sprintf("Error: Wrong number of requests in '%s'.", e))
+		}
+		per, err := time.ParseDuration(p[1])
+		if err != nil || per <= 0 {
+			return nil, errors.New(fmt.Sprintf("Error: Wrong duration in '%s'.", e))
+		}
+		res = append(res, RateLimit{N: n, Per: per})
+	}
+	return res, nil
+}
+
+// bucket : Token bucket which is filled with N tokens in Per.
+type bucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+// Limiter : Token bucket limiter of requests. A request waits until all buckets have a token.
+// When the response is the limit of requests or 503, the request is sent again with Retry-After or the exponential backoff with jitter.
+type Limiter struct {
+	Retry   int           // Number of retries for the limit of requests and 503.
+	MaxWait time.Duration // When Retry-After is longer than this, the response is returned without retrying.
+	Backoff time.Duration // First wait of the exponential backoff without Retry-After.
+
+	mu      sync.Mutex
+	buckets []*bucket
+}
+
+// NewLimiter : Create a limiter with limits. The buckets are full at first.
+func NewLimiter(limits ...RateLimit) *Limiter {
+	l := &Limiter{Retry: 3, MaxWait: time.Minute, Backoff: time.Second}
+	l.SetLimits(limits...)
+	return l
+}
+
+// SetLimits : Replace the limits. Without limits, requests are not limited.
+func (l *Limiter) SetLimits(limits ...RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buckets = nil
+	for _, r := range limits {
+		l.buckets = append(l.buckets, &bucket{limit: r, tokens: float64(r.N), last: time.Now()})
+	}
+}
+
+// reserve : Take a token from all buckets and return the duration to wait for it.
+// The tokens can be negative, so the following requests wait in order.
+func (l *Limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	var wait time.Duration
+	for _, b := range l.buckets {
+		rate := float64(b.limit.N) / float64(b.limit.Per)
+		b.tokens += float64(now.Sub(b.last)) * rate
+		if b.tokens > float64(b.limit.N) {
+			b.tokens = float64(b.limit.N)
+		}
+		b.last = now
+		b.tokens--
+		if b.tokens < 0 {
+			if d := time.Duration(-b.tokens / rate); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
+
+// Wait : Wait until a request is allowed.
+func (l *Limiter) Wait() {
+	if d := l.reserve(); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// backoff : Retrieve the duration to wait before the retry of n (0, 1, 2...). Retry-After is used when it is given.
+func (l *Limiter) backoff(res *http.Response, n int) time.Duration {
+	if s := res.Header.Get("Retry-After"); s != "" {
+		if sec, err := strconv.Atoi(s); err == nil {
+			return time.Duration(sec) * time.Second
+		}
+		if t, err := http.ParseTime(s); err == nil {
+			return time.Until(t)
+		}
+	}
+	d := l.Backoff << uint(n)
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// limiter : Limiter shared by all requests to Netatmo in the process.
+var limiter = NewLimiter(DefaultRateLimits...)
+
+// SetRateLimits : Replace the limits of requests to Netatmo in the process. Without limits, requests are not limited.
+func SetRateLimits(limits ...RateLimit) {
+	limiter.SetLimits(limits...)
+}
@@ -0,0 +1,146 @@
+package netatmo
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []RateLimit
+		err  bool
+	}{
+		{"50/10s,500/1h", []RateLimit{{50, 10 * time.Second}, {500, time.Hour}}, false},
+		{" 20/10s ", []RateLimit{{20, 10 * time.Second}}, false},
+		{"off", []RateLimit{}, false},
+		{"50-10s", nil, true},
+		{"0/10s", nil, true},
+		{"x/10s", nil, true},
+		{"50/10", nil, true},
+		{"50/-1s", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRateLimits(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error is %v", tt.in, err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLimiterWait(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   []RateLimit
+		requests int
+		min, max time.Duration
+	}{
+		{"no limit", nil, 100, 0, 50 * time.Millisecond},
+		{"within burst", []RateLimit{{10, time.Second}}, 10, 0, 50 * time.Millisecond},
+		{"over burst", []RateLimit{{5, 500 * time.Millisecond}}, 10, 400 * time.Millisecond, 800 * time.Millisecond},
+		{"strictest limit", []RateLimit{{100, time.Second}, {2, 200 * time.Millisecond}}, 4, 150 * time.Millisecond, 400 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(tt.limits...)
+			start := time.Now()
+			for i := 0; i < tt.requests; i++ {
+				l.Wait()
+			}
+			if d := time.Since(start); d < tt.min || d > tt.max {
+				t.Errorf("%d requests took %v, want %v-%v", tt.requests, d, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestLimiterBackoff(t *testing.T) {
+	l := NewLimiter()
+	tests := []struct {
+		name       string
+		retryAfter string
+		n          int
+		min, max   time.Duration
+	}{
+		{"Retry-After seconds", "7", 0, 7 * time.Second, 7 * time.Second},
+		{"Retry-After date", time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat), 0, 28 * time.Second, 30 * time.Second},
+		{"first backoff", "", 0, 500 * time.Millisecond, time.Second},
+		{"third backoff", "", 2, 2 * time.Second, 4 * time.Second},
+		{"wrong Retry-After", "soon", 1, time.Second, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		res := &http.Response{Header: http.Header{}}
+		if tt.retryAfter != "" {
+			res.Header.Set("Retry-After", tt.retryAfter)
+		}
+		for i := 0; i < 20; i++ {
+			if d := l.backoff(res, tt.n); d < tt.min || d > tt.max {
+				t.Fatalf("%s: %v, want %v-%v", tt.name, d, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+func TestFetchRetry(t *testing.T) {
+	type reply struct {
+		status     int
+		retryAfter string
+		body       string
+	}
+	limited := reply{429, "0", `{"error":{"code":26,"message":"User usage reached"}}`}
+	quota := reply{403, "", `{"error":{"code":26,"message":"User usage reached"}}`}
+	ok := reply{200, "", `{"body":{},"status":"ok"}`}
+	tests := []struct {
+		name    string
+		replies []reply
+		calls   int
+		err     func(error) bool
+	}{
+		{"429 with Retry-After", []reply{limited, limited, ok}, 3, nil},
+		{"403 with the error code 26", []reply{quota, ok}, 2, nil},
+		{"503", []reply{{503, "", "unavailable"}, ok}, 2, nil},
+		{"give up after retries", []reply{limited, limited, limited, limited, ok}, 4, IsRateLimited},
+		{"Retry-After over MaxWait", []reply{{429, "3600", ""}, ok}, 1, IsRateLimited},
+		{"no retry for invalid token", []reply{{403, "", `{"error":{"code":2,"message":"Invalid access_token"}}`}, ok}, 1, IsInvalidToken},
+		{"no retry for device not found", []reply{{400, "", `{"error":{"code":9,"message":"Device not found"}}`}, ok}, 1, IsDeviceNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				rp := tt.replies[calls]
+				calls++
+				if rp.retryAfter != "" {
+					w.Header().Set("Retry-After", rp.retryAfter)
+				}
+				w.WriteHeader(rp.status)
+				fmt.Fprint(w, rp.body)
+			}))
+			defer srv.Close()
+			l := NewLimiter()
+			l.Backoff = time.Millisecond
+			r := &RequestParams{Method: "GET", APIURL: srv.URL, Dtime: 10, Limiter: l}
+			body, err := r.getNetatmoValues()
+			if calls != tt.calls {
+				t.Errorf("requests = %d, want %d", calls, tt.calls)
+			}
+			switch {
+			case tt.err == nil && err != nil:
+				t.Errorf("error is %v", err)
+			case tt.err == nil && !strings.Contains(string(body), `"ok"`):
+				t.Errorf("body is %s", body)
+			case tt.err != nil && !tt.err(err):
+				t.Errorf("error is %v", err)
+			}
+		})
+	}
+}
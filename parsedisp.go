@@ -6,27 +6,17 @@ import (
 	"fmt"
 	"math"
 	"os"
-	"reflect"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/tanaikech/gonetatmo/netatmo"
 )
 
 const (
 	mestimeThreshold = 3600 // [second] Threshold for time of measure cycle.
 )
 
-// getstationsdataSt : Structure of getstationsdata.
-type getstationsdataStForParse struct {
-	Body struct {
-		Devices []interface{} `json:"devices"`
-		User    struct {
-			Mail string `json:"mail"`
-		} `json:"user"`
-	} `json:"body"`
-	Status string `json:"status"`
-}
-
 // stations : For detail version.
 type stations struct {
 	Stations []stationsdataForOutput `json:"stations,omitempty"`
@@ -34,14 +24,16 @@ type stations struct {
 
 // stationsdataForOutput : For detail version.
 type stationsdataForOutput struct {
-	Inside  []insideData  `json:"insideData,omitempty"`
-	Outside []outsideData `json:"outsideData,omitempty"`
+	Inside       []insideData  `json:"insideData,omitempty"`
+	IndoorModule []outsideData `json:"indoorModuleData,omitempty"`
+	Outside      []outsideData `json:"outsideData,omitempty"`
 }
 
 // insideData : Structure for data of inside device.
 type insideData struct {
 	Id               string  `json:"id,omitempty"`
 	StationName      string  `json:"station_name,omitempty"`
+	ModuleName       string  `json:"module_name,omitempty"`
 	TimeUtc          int64   `json:"time_utc,omitempty"`
 	MesTime          string  `json:"Measurement_time,omitempty"`
 	AbsolutePressure float64 `json:"AbsolutePressure,omitempty"`
@@ -60,44 +52,38 @@ type insideData struct {
 	FirmWare         int     `json:"firmware,omitempty"`
 }
 
-// outsideData : Structure for data of outside device.
+// outsideData : Structure for data of modules. Additional indoor modules also use this.
 type outsideData struct {
 	Id             string  `json:"id,omitempty"`
 	ModuleName     string  `json:"module_name,omitempty"`
+	Type           string  `json:"type,omitempty"`
+	Label          string  `json:"label,omitempty"`
 	TimeUtc        int64   `json:"time_utc,omitempty"`
 	MesTime        string  `json:"Measurement_time,omitempty"`
 	Temperature    float64 `json:"Temperature,omitempty"`
 	TempTrend      string  `json:"temp_trend,omitempty"`
 	Humidity       float64 `json:"Humidity,omitempty"`
+	CO2            int     `json:"CO2,omitempty"`
 	DateMaxTemp    int64   `json:"date_max_temp,omitempty"`
 	DateMinTemp    int64   `json:"date_min_temp,omitempty"`
 	MinTemp        float64 `json:"min_temp,omitempty"`
 	MaxTemp        float64 `json:"max_temp,omitempty"`
+	WindStrength   int     `json:"WindStrength"`
+	WindAngle      int     `json:"WindAngle"`
+	GustStrength   int     `json:"GustStrength"`
+	GustAngle      int     `json:"GustAngle"`
+	MaxWindStr     int     `json:"max_wind_str,omitempty"`
+	MaxWindAngle   int     `json:"max_wind_angle,omitempty"`
+	DateMaxWindStr int64   `json:"date_max_wind_str,omitempty"`
+	Rain           float64 `json:"Rain"`
+	SumRain1       float64 `json:"sum_rain_1"`
+	SumRain24      float64 `json:"sum_rain_24"`
 	BatteryVp      int     `json:"battery_vp,omitempty"`
 	BatteryPercent int     `json:"battery_percent,omitempty"`
 	RfStatus       int     `json:"rf_status,omitempty"`
 	FirmWare       int     `json:"firmware,omitempty"`
 }
 
-// publicData : Structure for public data.
-type publicData struct {
-	Body []struct {
-		ID    string `json:"_id"`
-		Place struct {
-			Location []float64 `json:"location"` // [0]longitude, [1]latitude
-			Altitude int       `json:"altitude"`
-			Timezone string    `json:"timezone"`
-		} `json:"place"`
-		Mark        int                    `json:"mark"`
-		Measures    map[string]interface{} `json:"measures"`
-		Modules     []string               `json:"modules"`
-		ModuleTypes map[string]interface{} `json:"module_types"`
-	} `json:"body"`
-	Status     string  `json:"status"`
-	TimeExec   float64 `json:"time_exec"`
-	TimeServer int     `json:"time_server"`
-}
-
 // createOutputFormatForgetPublicData : Create output format from results for getPublicData.
 func createOutputFormatForgetPublicData(rrr []map[string]interface{}, data [][]string) ([]string, [][]string) {
 	header := []string{"", "average", "number"}
@@ -168,44 +154,39 @@ func setSearchValues(search []string) []string {
 }
 
 // parsePublicdata : Parse retrieved public data.
-func parsePublicdata(search []string, data []byte) []map[string]interface{} {
+func parsePublicdata(search []string, pb *netatmo.PublicData) []map[string]interface{} {
 	nt := time.Now().Unix()
-	pb := &publicData{}
-	json.Unmarshal(data, &pb)
 	res := []map[string]interface{}{}
 	for _, e := range pb.Body {
 		t1 := map[string]interface{}{}
 		for _, f := range e.Measures {
-			if v, ok := f.(map[string]interface{})["res"]; ok {
-				for k, g := range v.(map[string]interface{}) {
-					i64, err := strconv.ParseInt(k, 10, 64)
-					if err != nil {
-						fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-						os.Exit(1)
-					}
-					if nt-i64 < mestimeThreshold {
-						for l, h := range g.([]interface{}) {
-							for _, s := range search {
-								if f.(map[string]interface{})["type"].([]interface{})[l].(string) == s {
-									t1[s] = h
-								}
+			for k, g := range f.Res {
+				i64, err := strconv.ParseInt(k, 10, 64)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				if nt-i64 < mestimeThreshold {
+					for l, h := range g {
+						for _, s := range search {
+							if l < len(f.Type) && f.Type[l] == s && h != nil {
+								t1[s] = *h
 							}
 						}
 					}
 				}
 			}
 			for _, s := range search {
-				if s == "rain" || s == "wind" {
-					if v, ok := f.(map[string]interface{})[s+"_timeutc"]; ok {
-						if nt-int64(v.(float64)) < mestimeThreshold {
-							for k, g := range f.(map[string]interface{}) {
-								if k == s+"_timeutc" {
-									continue
-								}
-								t1[k] = g
-							}
-						}
-					}
+				if s == "rain" && f.RainTimeUtc != nil && nt-*f.RainTimeUtc < mestimeThreshold {
+					setPublicValue(t1, "rain_60min", f.Rain60min)
+					setPublicValue(t1, "rain_24h", f.Rain24h)
+					setPublicValue(t1, "rain_live", f.RainLive)
+				}
+				if s == "wind" && f.WindTimeUtc != nil && nt-*f.WindTimeUtc < mestimeThreshold {
+					setPublicValue(t1, "wind_strength", f.WindStrength)
+					setPublicValue(t1, "wind_angle", f.WindAngle)
+					setPublicValue(t1, "gust_strength", f.GustStrength)
+					setPublicValue(t1, "gust_angle", f.GustAngle)
 				}
 			}
 		}
@@ -214,6 +195,251 @@ func parsePublicdata(search []string, data []byte) []map[string]interface{} {
 	return res
 }
 
+// setPublicValue : Set value to t1 when it was returned.
+func setPublicValue(t1 map[string]interface{}, key string, v *float64) {
+	if v != nil {
+		t1[key] = *v
+	}
+}
+
+// valueUnits : Units of types for getmeasure, getpublicdata and getstationsdata.
+var valueUnits = map[string]string{
+	"temperature":     "C",
+	"min_temp":        "C",
+	"max_temp":        "C",
+	"humidity":        "%",
+	"min_hum":         "%",
+	"max_hum":         "%",
+	"co2":             "ppm",
+	"min_co2":         "ppm",
+	"max_co2":         "ppm",
+	"pressure":        "hPa",
+	"min_pressure":    "hPa",
+	"max_pressure":    "hPa",
+	"noise":           "dB",
+	"min_noise":       "dB",
+	"max_noise":       "dB",
+	"rain":            "mm",
+	"sum_rain":        "mm",
+	"windstrength":    "km/h",
+	"windangle":       "deg",
+	"guststrength":    "km/h",
+	"gustangle":       "deg",
+	"sum_rain_1":      "mm",
+	"sum_rain_24":     "mm",
+	"rain_60min":      "mm",
+	"rain_24h":        "mm",
+	"rain_live":       "mm",
+	"wind_strength":   "km/h",
+	"wind_angle":      "deg",
+	"gust_strength":   "km/h",
+	"gust_angle":      "deg",
+	"max_wind_str":    "km/h",
+	"battery_percent": "%",
+}
+
+// unitColumn : Column name of type with the unit.
+func unitColumn(t string) string {
+	if u, ok := valueUnits[strings.ToLower(t)]; ok {
+		return t + " [" + u + "]"
+	}
+	return t
+}
+
+// parseMeasure : Parse retrieved measure data. Values are mapped to the requested types.
+func parseMeasure(types []string, points []netatmo.MeasurePoint) []map[string]interface{} {
+	res := []map[string]interface{}{}
+	for _, p := range points {
+		t1 := map[string]interface{}{
+			"time_utc":         p.Time,
+			"Measurement_time": time.Unix(p.Time, 0).In(time.Local).Format("20060102 15:04:05 MST"),
+		}
+		for i, t := range types {
+			if i < len(p.Values) && p.Values[i] != nil {
+				t1[t] = *p.Values[i]
+			} else {
+				t1[t] = nil
+			}
+		}
+		res = append(res, t1)
+	}
+	return res
+}
+
+// createOutputFormatForgetmeasure : Create output format from results for getmeasure. Times are formatted by layout.
+func createOutputFormatForgetmeasure(types []string, res []map[string]interface{}, layout string) ([]string, [][]string) {
+	header := []string{"Measurement time"}
+	for _, t := range types {
+		header = append(header, unitColumn(t))
+	}
+	var data [][]string
+	for _, e := range res {
+		temp := []string{time.Unix(e["time_utc"].(int64), 0).In(time.Local).Format(layout)}
+		for _, t := range types {
+			if v, ok := e[t].(float64); ok {
+				temp = append(temp, strconv.FormatFloat(v, 'f', -1, 64))
+			} else {
+				temp = append(temp, "")
+			}
+		}
+		data = append(data, temp)
+	}
+	return header, data
+}
+
+// formatCSVFloat : Format value for CSV. Empty string is returned when the value is not used.
+func formatCSVFloat(v float64, used bool) string {
+	if !used {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// formatCSVTime : Format unix time as ISO-8601 for CSV.
+func formatCSVTime(t int64) string {
+	if t == 0 {
+		return ""
+	}
+	return time.Unix(t, 0).In(time.Local).Format(time.RFC3339)
+}
+
+// createCSVForgetStationsData : Create CSV rows from results for getStationsData. One row is created for each module.
+func createCSVForgetStationsData(s *stations) ([]string, [][]string) {
+	header := []string{
+		"station_name",
+		"module_id",
+		"module_name",
+		"type",
+		"label",
+		"time",
+		"status",
+		unitColumn("Temperature"),
+		unitColumn("Humidity"),
+		unitColumn("Pressure"),
+		unitColumn("CO2"),
+		unitColumn("Noise"),
+		unitColumn("WindStrength"),
+		unitColumn("WindAngle"),
+		unitColumn("GustStrength"),
+		unitColumn("GustAngle"),
+		unitColumn("max_wind_str"),
+		unitColumn("Rain"),
+		unitColumn("sum_rain_1"),
+		unitColumn("sum_rain_24"),
+		unitColumn("battery_percent"),
+		"wifi_status",
+		"rf_status",
+		"firmware",
+	}
+	status := func(t int64) string {
+		if time.Now().Unix()-t > mestimeThreshold {
+			return "Not working!"
+		}
+		return "Working."
+	}
+	var data [][]string
+	for _, st := range s.Stations {
+		stationName := ""
+		for _, f := range st.Inside {
+			stationName = f.StationName
+			data = append(data, []string{
+				f.StationName,
+				f.Id,
+				f.ModuleName,
+				netatmo.TypeMain,
+				moduleLabel(netatmo.TypeMain),
+				formatCSVTime(f.TimeUtc),
+				status(f.TimeUtc),
+				formatCSVFloat(f.Temperature, true),
+				formatCSVFloat(f.Humidity, true),
+				formatCSVFloat(f.Pressure, true),
+				strconv.Itoa(f.CO2),
+				strconv.Itoa(f.Noise),
+				"", "", "", "", "", "", "", "", "",
+				strconv.Itoa(f.WifiStatus),
+				"",
+				strconv.Itoa(f.FirmWare),
+			})
+		}
+		for _, f := range append(append([]outsideData{}, st.IndoorModule...), st.Outside...) {
+			thermo := f.Type != netatmo.TypeWind && f.Type != netatmo.TypeRain
+			wind := f.Type == netatmo.TypeWind
+			rain := f.Type == netatmo.TypeRain
+			co2 := ""
+			if f.Type == netatmo.TypeIndoor {
+				co2 = strconv.Itoa(f.CO2)
+			}
+			data = append(data, []string{
+				stationName,
+				f.Id,
+				f.ModuleName,
+				f.Type,
+				f.Label,
+				formatCSVTime(f.TimeUtc),
+				status(f.TimeUtc),
+				formatCSVFloat(f.Temperature, thermo),
+				formatCSVFloat(f.Humidity, thermo),
+				"",
+				co2,
+				"",
+				formatCSVFloat(float64(f.WindStrength), wind),
+				formatCSVFloat(float64(f.WindAngle), wind),
+				formatCSVFloat(float64(f.GustStrength), wind),
+				formatCSVFloat(float64(f.GustAngle), wind),
+				formatCSVFloat(float64(f.MaxWindStr), wind),
+				formatCSVFloat(f.Rain, rain),
+				formatCSVFloat(f.SumRain1, rain),
+				formatCSVFloat(f.SumRain24, rain),
+				strconv.Itoa(f.BatteryPercent),
+				"",
+				strconv.Itoa(f.RfStatus),
+				strconv.Itoa(f.FirmWare),
+			})
+		}
+	}
+	return header, data
+}
+
+// publicStationTime : Retrieve the latest timestamp of measures of a public station.
+func publicStationTime(e netatmo.PublicStation) int64 {
+	var t int64
+	for _, f := range e.Measures {
+		for k := range f.Res {
+			if i64, err := strconv.ParseInt(k, 10, 64); err == nil && i64 > t {
+				t = i64
+			}
+		}
+		for _, v := range []*int64{f.RainTimeUtc, f.WindTimeUtc} {
+			if v != nil && *v > t {
+				t = *v
+			}
+		}
+	}
+	return t
+}
+
+// createCSVForgetPublicData : Create CSV rows from results for getPublicData. One row is created for each station.
+func createCSVForgetPublicData(sv []string, pb *netatmo.PublicData, res []map[string]interface{}) ([]string, [][]string) {
+	header := []string{"id", "time", "latitude", "longitude", "altitude [m]", "timezone"}
+	for _, s := range sv {
+		header = append(header, unitColumn(s))
+	}
+	var data [][]string
+	for i, e := range pb.Body {
+		temp := []string{e.ID, formatCSVTime(publicStationTime(e)), "", "", strconv.FormatFloat(e.Place.Altitude, 'f', -1, 64), e.Place.Timezone}
+		if len(e.Place.Location) == 2 {
+			temp[2] = strconv.FormatFloat(e.Place.Location[1], 'f', -1, 64)
+			temp[3] = strconv.FormatFloat(e.Place.Location[0], 'f', -1, 64)
+		}
+		for _, s := range sv {
+			v, ok := res[i][s].(float64)
+			temp = append(temp, formatCSVFloat(v, ok))
+		}
+		data = append(data, temp)
+	}
+	return header, data
+}
+
 // transpose : Transpose slice. Slice of (n x m) to (m x n).
 func transpose(slice [][]string) [][]string {
 	xl := len(slice[0])
@@ -244,154 +470,228 @@ func (sim *stations) createOutputFormatForgetStationsData(i int, e stationsdataF
 		"Pressure trend",
 		"CO2 [ppm]",
 		"Noise [dB]",
+	}
+	hasWind, hasRain := false, false
+	for _, st := range sim.Stations {
+		for _, f := range st.Outside {
+			hasWind = hasWind || f.Type == netatmo.TypeWind
+			hasRain = hasRain || f.Type == netatmo.TypeRain
+		}
+	}
+	if hasWind {
+		col1 = append(col1,
+			"Wind strength [km/h]",
+			"Wind angle [deg]",
+			"Gust strength [km/h]",
+			"Gust angle [deg]",
+			"Max wind strength [km/h]",
+		)
+	}
+	if hasRain {
+		col1 = append(col1,
+			"Rain [mm]",
+			"Rain 1h [mm]",
+			"Rain 24h [mm]",
+		)
+	}
+	col1 = append(col1,
 		"WifiStatus",
 		"Battery [%]",
 		"Firmware",
-	}
+	)
 	data = append(data, col1)
+	status := func(t int64) string {
+		if time.Now().Unix()-t > mestimeThreshold {
+			return "Not working!"
+		}
+		return "Working."
+	}
+	column := func(values map[string]string) []string {
+		temp := make([]string, len(col1))
+		for k, label := range col1 {
+			temp[k] = values[label]
+		}
+		return temp
+	}
 	for j, f := range e.Inside {
 		header = append(header, "in")
 		date := time.Unix(f.TimeUtc, 0)
 		out := date.In(time.Local).Format("20060102 15:04:05 MST")
 		sim.Stations[i].Inside[j].MesTime = out
 		sim.Stations[i].Inside[j].TimeUtc = 0
-		status := func(t int64) string {
-			if time.Now().Unix()-t > mestimeThreshold {
-				return "Not working!"
-			}
-			return "Working."
-		}(f.TimeUtc)
-		temp := []string{
-			f.Id,
-			status,
-			out,
-			strconv.FormatFloat(f.Temperature, 'f', 1, 64),
-			f.TempTrend,
-			strconv.FormatFloat(f.Humidity, 'f', 1, 64),
-			strconv.FormatFloat(f.Pressure, 'f', 1, 64),
-			f.PressureTrend,
-			strconv.Itoa(f.CO2),
-			strconv.Itoa(f.Noise),
-			strconv.Itoa(f.WifiStatus),
-			"",
-			strconv.Itoa(f.FirmWare),
+		data = append(data, column(map[string]string{
+			"ID":                f.Id,
+			"Status":            status(f.TimeUtc),
+			"Measurement time":  out,
+			"Temperature [C]":   strconv.FormatFloat(f.Temperature, 'f', 1, 64),
+			"Temperature trend": f.TempTrend,
+			"Humidity [%]":      strconv.FormatFloat(f.Humidity, 'f', 1, 64),
+			"Pressure [hPa]":    strconv.FormatFloat(f.Pressure, 'f', 1, 64),
+			"Pressure trend":    f.PressureTrend,
+			"CO2 [ppm]":         strconv.Itoa(f.CO2),
+			"Noise [dB]":        strconv.Itoa(f.Noise),
+			"WifiStatus":        strconv.Itoa(f.WifiStatus),
+			"Firmware":          strconv.Itoa(f.FirmWare),
+		}))
+	}
+	module := func(f outsideData) []string {
+		values := map[string]string{
+			"ID":               f.Id,
+			"Status":           status(f.TimeUtc),
+			"Measurement time": time.Unix(f.TimeUtc, 0).In(time.Local).Format("20060102 15:04:05 MST"),
+			"WifiStatus":       strconv.Itoa(f.RfStatus),
+			"Battery [%]":      strconv.Itoa(f.BatteryPercent),
+			"Firmware":         strconv.Itoa(f.FirmWare),
 		}
-		data = append(data, temp)
+		switch f.Type {
+		case netatmo.TypeWind:
+			header = append(header, "wind")
+			values["Wind strength [km/h]"] = strconv.Itoa(f.WindStrength)
+			values["Wind angle [deg]"] = strconv.Itoa(f.WindAngle)
+			values["Gust strength [km/h]"] = strconv.Itoa(f.GustStrength)
+			values["Gust angle [deg]"] = strconv.Itoa(f.GustAngle)
+			values["Max wind strength [km/h]"] = strconv.Itoa(f.MaxWindStr)
+		case netatmo.TypeRain:
+			header = append(header, "rain")
+			values["Rain [mm]"] = strconv.FormatFloat(f.Rain, 'f', 1, 64)
+			values["Rain 1h [mm]"] = strconv.FormatFloat(f.SumRain1, 'f', 1, 64)
+			values["Rain 24h [mm]"] = strconv.FormatFloat(f.SumRain24, 'f', 1, 64)
+		case netatmo.TypeIndoor:
+			header = append(header, f.Label+" ("+f.ModuleName+")")
+			values["Temperature [C]"] = strconv.FormatFloat(f.Temperature, 'f', 1, 64)
+			values["Temperature trend"] = f.TempTrend
+			values["Humidity [%]"] = strconv.FormatFloat(f.Humidity, 'f', 1, 64)
+			values["CO2 [ppm]"] = strconv.Itoa(f.CO2)
+		default:
+			header = append(header, "out")
+			values["Temperature [C]"] = strconv.FormatFloat(f.Temperature, 'f', 1, 64)
+			values["Temperature trend"] = f.TempTrend
+			values["Humidity [%]"] = strconv.FormatFloat(f.Humidity, 'f', 1, 64)
+		}
+		return column(values)
+	}
+	for j, f := range e.IndoorModule {
+		data = append(data, module(f))
+		sim.Stations[i].IndoorModule[j].MesTime = time.Unix(f.TimeUtc, 0).In(time.Local).Format("20060102 15:04:05 MST")
+		sim.Stations[i].IndoorModule[j].TimeUtc = 0
 	}
 	for j, f := range e.Outside {
-		header = append(header, "out")
-		date := time.Unix(f.TimeUtc, 0)
-		out := date.In(time.Local).Format("20060102 15:04:05 MST")
-		sim.Stations[i].Outside[j].MesTime = out
+		data = append(data, module(f))
+		sim.Stations[i].Outside[j].MesTime = time.Unix(f.TimeUtc, 0).In(time.Local).Format("20060102 15:04:05 MST")
 		sim.Stations[i].Outside[j].TimeUtc = 0
-		status := func(t int64) string {
-			if time.Now().Unix()-t > mestimeThreshold {
-				return "Not working!"
-			}
-			return "Working."
-		}(f.TimeUtc)
-		temp := []string{
-			f.Id,
-			status,
-			out,
-			strconv.FormatFloat(f.Temperature, 'f', 1, 64),
-			f.TempTrend,
-			strconv.FormatFloat(f.Humidity, 'f', 1, 64),
-			"",
-			"",
-			"",
-			"",
-			strconv.Itoa(f.RfStatus),
-			strconv.Itoa(f.BatteryPercent),
-			strconv.Itoa(f.FirmWare),
-		}
-		data = append(data, temp)
 	}
 	return header, transpose(data)
 }
 
 // getInsideData : Retrieve data from inside devices.
-func (so *stationsdataForOutput) getInsideData(e interface{}) {
-	inDat := &insideData{}
-	s := reflect.ValueOf(inDat).Elem()
-	typeOfT := s.Type()
-	inDat.Id = e.(map[string]interface{})["_id"].(string)
-	inDat.WifiStatus = int(e.(map[string]interface{})["wifi_status"].(float64))
-	inDat.FirmWare = int(e.(map[string]interface{})["firmware"].(float64))
-	for i := 0; i < s.NumField(); i++ {
-		for j, f := range e.(map[string]interface{})["dashboard_data"].(map[string]interface{}) {
-			if strings.Split(typeOfT.Field(i).Tag.Get("json"), ",")[0] == j {
-				fl := s.FieldByName(typeOfT.Field(i).Name)
-				switch fl.Kind() {
-				case reflect.Int, reflect.Int64:
-					c, _ := f.(float64)
-					fl.SetInt(int64(c))
-				case reflect.Float64:
-					f64, _ := f.(float64)
-					fl.SetFloat(f64)
-				case reflect.String:
-					fl.SetString(f.(string))
-				}
-			}
-			if inDat.TimeUtc > 0 && inDat.MesTime == "" {
-				date := time.Unix(inDat.TimeUtc, 0)
-				inDat.MesTime = date.In(time.Local).Format("20060102_15:04:05_MST")
-			}
-		}
+func (so *stationsdataForOutput) getInsideData(d netatmo.Device) {
+	dd := d.DashboardData
+	inDat := &insideData{
+		Id:               d.ID,
+		StationName:      d.StationName,
+		ModuleName:       d.ModuleName,
+		TimeUtc:          dd.TimeUtc,
+		AbsolutePressure: dd.AbsolutePressure,
+		Noise:            dd.Noise,
+		Temperature:      dd.Temperature,
+		TempTrend:        dd.TempTrend,
+		Humidity:         dd.Humidity,
+		Pressure:         dd.Pressure,
+		PressureTrend:    dd.PressureTrend,
+		CO2:              dd.CO2,
+		DateMaxTemp:      dd.DateMaxTemp,
+		DateMinTemp:      dd.DateMinTemp,
+		MinTemp:          dd.MinTemp,
+		MaxTemp:          dd.MaxTemp,
+		WifiStatus:       d.WifiStatus,
+		FirmWare:         d.Firmware,
+	}
+	if inDat.TimeUtc > 0 {
+		date := time.Unix(inDat.TimeUtc, 0)
+		inDat.MesTime = date.In(time.Local).Format("20060102_15:04:05_MST")
 	}
 	so.Inside = append(so.Inside, *inDat)
 }
 
-// getOutsideData : Retrieve data from outside devices.
-func (so *stationsdataForOutput) getOutsideData(e interface{}) {
-	for _, f := range e.(map[string]interface{})["modules"].([]interface{}) {
-		otDat := &outsideData{}
-		s := reflect.ValueOf(otDat).Elem()
-		typeOfT := s.Type()
-		otDat.Id = f.(map[string]interface{})["_id"].(string)
-		otDat.RfStatus = int(f.(map[string]interface{})["rf_status"].(float64))
-		otDat.FirmWare = int(f.(map[string]interface{})["firmware"].(float64))
-		otDat.BatteryPercent = int(f.(map[string]interface{})["battery_percent"].(float64))
-		otDat.BatteryVp = int(f.(map[string]interface{})["battery_vp"].(float64))
-		if f.(map[string]interface{})["reachable"].(bool) {
-			for i := 0; i < s.NumField(); i++ {
-				for j, f := range f.(map[string]interface{})["dashboard_data"].(map[string]interface{}) {
-					if strings.Split(typeOfT.Field(i).Tag.Get("json"), ",")[0] == j {
-						fl := s.FieldByName(typeOfT.Field(i).Name)
-						switch fl.Kind() {
-						case reflect.Int, reflect.Int64:
-							c, _ := f.(float64)
-							fl.SetInt(int64(c))
-						case reflect.Float64:
-							f64, _ := f.(float64)
-							fl.SetFloat(f64)
-						case reflect.String:
-							fl.SetString(f.(string))
-						}
-					}
-					if otDat.TimeUtc > 0 && otDat.MesTime == "" {
-						date := time.Unix(otDat.TimeUtc, 0)
-						otDat.MesTime = date.In(time.Local).Format("20060102_15:04:05_MST")
-					}
-				}
+// getOutsideData : Retrieve data from modules. Additional indoor modules are classified into IndoorModule.
+func (so *stationsdataForOutput) getOutsideData(d netatmo.Device) {
+	for _, f := range d.Modules {
+		otDat := &outsideData{
+			Id:             f.ID,
+			ModuleName:     f.ModuleName,
+			Type:           f.Type,
+			Label:          moduleLabel(f.Type),
+			RfStatus:       f.RfStatus,
+			FirmWare:       f.Firmware,
+			BatteryPercent: f.BatteryPercent,
+			BatteryVp:      f.BatteryVp,
+		}
+		if f.Reachable {
+			dd := f.DashboardData
+			otDat.TimeUtc = dd.TimeUtc
+			otDat.Temperature = dd.Temperature
+			otDat.TempTrend = dd.TempTrend
+			otDat.Humidity = dd.Humidity
+			otDat.CO2 = dd.CO2
+			otDat.DateMaxTemp = dd.DateMaxTemp
+			otDat.DateMinTemp = dd.DateMinTemp
+			otDat.MinTemp = dd.MinTemp
+			otDat.MaxTemp = dd.MaxTemp
+			otDat.WindStrength = dd.WindStrength
+			otDat.WindAngle = dd.WindAngle
+			otDat.GustStrength = dd.GustStrength
+			otDat.GustAngle = dd.GustAngle
+			otDat.MaxWindStr = dd.MaxWindStr
+			otDat.MaxWindAngle = dd.MaxWindAngle
+			otDat.DateMaxWindStr = dd.DateMaxWindStr
+			otDat.Rain = dd.Rain
+			otDat.SumRain1 = dd.SumRain1
+			otDat.SumRain24 = dd.SumRain24
+			if otDat.TimeUtc > 0 {
+				date := time.Unix(otDat.TimeUtc, 0)
+				otDat.MesTime = date.In(time.Local).Format("20060102_15:04:05_MST")
 			}
 		}
-		so.Outside = append(so.Outside, *otDat)
+		if f.Type == netatmo.TypeIndoor {
+			so.IndoorModule = append(so.IndoorModule, *otDat)
+		} else {
+			so.Outside = append(so.Outside, *otDat)
+		}
 	}
 }
 
-// parseStationsData : Parse stations data
-func parseStationsData(res []byte) []byte {
+// moduleLabel : Label of module for displaying.
+func moduleLabel(moduleType string) string {
+	switch moduleType {
+	case netatmo.TypeMain:
+		return "base station"
+	case netatmo.TypeOutdoor:
+		return "outdoor module"
+	case netatmo.TypeWind:
+		return "wind gauge"
+	case netatmo.TypeRain:
+		return "rain gauge"
+	case netatmo.TypeIndoor:
+		return "indoor module"
+	}
+	return "module"
+}
+
+// newStations : Create stations from stations data.
+func newStations(sd *netatmo.StationsData) *stations {
 	s := &stations{}
-	rs := &getstationsdataStForParse{}
-	json.Unmarshal(res, &rs)
-	for _, e := range rs.Body.Devices {
+	for _, e := range sd.Body.Devices {
 		so := &stationsdataForOutput{}
 		so.getInsideData(e)
 		so.getOutsideData(e)
 		s.Stations = append(s.Stations, *so)
 	}
-	si, err := json.Marshal(s)
+	return s
+}
+
+// parseStationsData : Parse stations data
+func parseStationsData(sd *netatmo.StationsData) []byte {
+	si, err := json.Marshal(newStations(sd))
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
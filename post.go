@@ -0,0 +1,54 @@
+// Package main (post.go) :
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// retryWait : First wait of the exponential backoff of postWithRetry.
+var retryWait = time.Second
+
+// postWithRetry : Post body to url with headers. Network errors, 429 and 5xx are retried up to retry times with the exponential backoff.
+// name is the name of the service for the error message like "InfluxDB". When client is nil, a client with the timeout of 30 seconds is used.
+func postWithRetry(client *http.Client, url string, headers map[string]string, body []byte, retry int, name string) error {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	var err error
+	wait := retryWait
+	for i := 0; i <= retry; i++ {
+		if i > 0 {
+			time.Sleep(wait)
+			wait *= 2
+		}
+		var req *http.Request
+		req, err = http.NewRequest("POST", url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		var res *http.Response
+		res, err = client.Do(req)
+		if err != nil {
+			continue
+		}
+		msg, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode/100 == 2 {
+			return nil
+		}
+		err = errors.New(fmt.Sprintf("Error: %s returned %s. %s", name, res.Status, strings.TrimSpace(string(msg))))
+		if res.StatusCode != http.StatusTooManyRequests && res.StatusCode < 500 {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,304 @@
+// Package main (profile.go) :
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+const (
+	defaultProfile = "default"
+	profileEnv     = "GONETATMO_PROFILE"
+)
+
+// profilesFile : Config file with named profiles. The config file without "profiles" is used as the profile of "default".
+type profilesFile struct {
+	DefaultProfile string                 `json:"default_profile,omitempty"`
+	Profiles       map[string]*configFile `json:"profiles"`
+}
+
+// parseProfiles : Parse the config file.
+func parseProfiles(b []byte) (*profilesFile, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(b, &probe); err != nil {
+		return nil, err
+	}
+	pf := &profilesFile{}
+	if _, ok := probe["profiles"]; ok {
+		if err := json.Unmarshal(b, pf); err != nil {
+			return nil, err
+		}
+		if pf.Profiles == nil {
+			pf.Profiles = map[string]*configFile{}
+		}
+		return pf, nil
+	}
+	cf := &configFile{}
+	if err := json.Unmarshal(b, cf); err != nil {
+		return nil, err
+	}
+	pf.Profiles = map[string]*configFile{defaultProfile: cf}
+	return pf, nil
+}
+
+// marshal : Convert to JSON. When there is only the profile of "default", the old format is used for compatibility.
+func (pf *profilesFile) marshal() ([]byte, error) {
+	if cf, ok := pf.Profiles[defaultProfile]; ok && len(pf.Profiles) == 1 && (pf.DefaultProfile == "" || pf.DefaultProfile == defaultProfile) {
+		return json.MarshalIndent(cf, "", "\t")
+	}
+	return json.MarshalIndent(pf, "", "\t")
+}
+
+// loadProfiles : Read all profiles from the store. When the config file doesn't exist, the profiles are empty and os.ErrNotExist is returned.
+func (m *materials) loadProfiles() error {
+	m.profiles = &profilesFile{Profiles: map[string]*configFile{}}
+	s, err := m.secretStore()
+	if err != nil {
+		return err
+	}
+	b, err := s.Load()
+	if err != nil {
+		return err
+	}
+	pf, err := parseProfiles(b)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error: '%s' is broken. %v", cfgFile, err))
+	}
+	m.profiles = pf
+	return nil
+}
+
+// profileName : Retrieve the name of the selected profile.
+func (m *materials) profileName() string {
+	if m.profile != "" {
+		return m.profile
+	}
+	if m.profiles != nil && m.profiles.DefaultProfile != "" {
+		return m.profiles.DefaultProfile
+	}
+	return defaultProfile
+}
+
+// selectProfile : Use the selected profile as configFile. When create is true, a new profile is created if it doesn't exist.
+func (m *materials) selectProfile(create bool) error {
+	name := m.profileName()
+	cf, ok := m.profiles.Profiles[name]
+	if !ok {
+		if !create {
+			return errors.New(fmt.Sprintf("Profile '%s' is not found. Please add it.\n\n $ gonetatmo profile add %s --clientid ### --clientsecret ###\n", name, name))
+		}
+		cf = &configFile{}
+		m.profiles.Profiles[name] = cf
+	}
+	if cf.tokens == nil {
+		cf.tokens = &tokens{}
+	}
+	m.configFile = cf
+	return nil
+}
+
+// applyOptions : Set the default values of flags of the profile. Flags inputted by the command line and the environment variables are not changed.
+// The options which are not the flags of the command are skipped, because a profile is used by all commands.
+func (m *materials) applyOptions(c *cli.Context) error {
+	for k, v := range m.configFile.Options {
+		if inputtedFlag(c, k) != nil {
+			continue
+		}
+		if err := setFlag(c, k, v); err != nil {
+			return errors.New(fmt.Sprintf("Error: Couldn't apply the option '%s=%s' of profile '%s'. %v", k, v, m.profileName(), err))
+		}
+	}
+	return nil
+}
+
+// setFlag : Set the flag to the context which defines it. Context.Set sets only the flags of the context itself,
+// so the global flags like "ratelimit" are set to the parent context. When no context defines the flag, nothing is done.
+func setFlag(c *cli.Context, name, value string) error {
+	for _, ctx := range c.Lineage() {
+		if err := ctx.Set(name, value); err == nil || !strings.HasPrefix(err.Error(), "no such flag") {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseOptions : Parse options of "key=value".
+func parseOptions(opts []string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, o := range opts {
+		i := strings.Index(o, "=")
+		if i <= 0 {
+			return nil, errors.New(fmt.Sprintf("Error: Wrong option '%s'. Please use 'key=value' like 'deviceid=12:34:56:78:90:12'.", o))
+		}
+		res[strings.TrimSpace(o[:i])] = strings.TrimSpace(o[i+1:])
+	}
+	return res, nil
+}
+
+// listProfiles : Display profiles.
+func (m *materials) listProfiles() {
+	names := make([]string, 0, len(m.profiles.Profiles))
+	for k := range m.profiles.Profiles {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var data [][]string
+	for _, n := range names {
+		cf := m.profiles.Profiles[n]
+		def := ""
+		if n == m.profileName() {
+			def = "*"
+		}
+		expire := ""
+		if cf.tokens != nil && cf.tokens.EndTime > 0 {
+			expire = time.Unix(cf.tokens.EndTime, 0).In(time.Local).Format("20060102 15:04:05 MST")
+		}
+		var opts []string
+		for k, v := range cf.Options {
+			opts = append(opts, k+"="+v)
+		}
+		sort.Strings(opts)
+		scopes := cf.Scopes
+		if cf.tokens != nil && len(cf.tokens.Scope) > 0 {
+			scopes = cf.tokens.Scope
+		}
+		data = append(data, []string{def, n, cf.ClientId, strings.Join(scopes, ","), expire, strings.Join(opts, " ")})
+	}
+	dispTable([]string{"", "Profile", "Client ID", "Scopes", "Token expiration", "Options"}, data)
+}
+
+// profileHandler : Manage profiles. Netatmo is not accessed.
+func profileHandler(c *cli.Context) error {
+	m := initParams()
+	m.profile = c.String("profile")
+	if err := m.loadProfiles(); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	name := c.Args().First()
+	if c.Command.Name != "list" && name == "" {
+		fmt.Printf("Error: Please input the name of profile.\n\n $ gonetatmo profile %s ###\n\n", c.Command.Name)
+		os.Exit(1)
+	}
+	switch c.Command.Name {
+	case "list":
+		m.listProfiles()
+		return nil
+	case "add":
+		m.profile = name
+		m.selectProfile(true)
+		if err := m.resolveCredentials(c); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		clientID, clientSecret := m.clientID(), m.clientSecret()
+		var scopes []string
+		if c.String("scope") != "" {
+			var err error
+			if scopes, err = parseScopes(c.String("scope")); err != nil {
+				fmt.Printf("%v\n", err)
+				os.Exit(1)
+			}
+		}
+		opts, err := parseOptions(c.StringSlice("option"))
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		err = m.saveProfiles(func(pf *profilesFile) {
+			cf, ok := pf.Profiles[name]
+			if !ok {
+				cf = &configFile{tokens: &tokens{}}
+				pf.Profiles[name] = cf
+			}
+			cf.ClientId = clientID
+			cf.ClientSecret = clientSecret
+			if scopes != nil {
+				cf.Scopes = scopes
+			}
+			for k, v := range opts {
+				if cf.Options == nil {
+					cf.Options = map[string]string{}
+				}
+				if v == "" {
+					delete(cf.Options, k)
+				} else {
+					cf.Options[k] = v
+				}
+			}
+		})
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		if m.configFile.Accesstoken == "" {
+			fmt.Printf("Please authorize the profile.\n\n $ gonetatmo --profile %s auth login\n\n", name)
+		}
+	case "remove":
+		if _, ok := m.profiles.Profiles[name]; !ok {
+			fmt.Printf("Error: Profile '%s' is not found.\n", name)
+			os.Exit(1)
+		}
+		err := m.saveProfiles(func(pf *profilesFile) {
+			delete(pf.Profiles, name)
+			if pf.DefaultProfile == name {
+				pf.DefaultProfile = ""
+			}
+		})
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	case "default":
+		if _, ok := m.profiles.Profiles[name]; !ok {
+			fmt.Printf("Error: Profile '%s' is not found.\n", name)
+			os.Exit(1)
+		}
+		if err := m.saveProfiles(func(pf *profilesFile) { pf.DefaultProfile = name }); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+	return nil
+}
+
+// saveProfiles : Apply update to the profiles holding the lock of the config file. Please see updateProfiles.
+func (m *materials) saveProfiles(update func(pf *profilesFile)) error {
+	unlock, err := m.lockCfg()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return m.updateProfiles(update)
+}
+
+// updateProfiles : Read the config file again, apply update to the profiles and write them to the store. So the profiles
+// updated by other processes after this process loaded them, like the tokens refreshed by the daemon, are not overwritten.
+// The selected profile is used from the updated profiles. Please hold the lock by lockCfg.
+func (m *materials) updateProfiles(update func(pf *profilesFile)) error {
+	if err := m.loadProfiles(); err != nil && !os.IsNotExist(err) {
+		return errors.New(fmt.Sprintf("Error: Couldn't update '%s'. %v", cfgFile, err))
+	}
+	update(m.profiles)
+	file, err := m.profiles.marshal()
+	if err != nil {
+		return err
+	}
+	s, err := m.secretStore()
+	if err != nil {
+		return err
+	}
+	if err := s.Save(file); err != nil {
+		return errors.New(fmt.Sprintf("Error: Couldn't update '%s'. %v", cfgFile, err))
+	}
+	m.selectProfile(false)
+	fmt.Fprintf(os.Stderr, "Updated '%s' at %s. \n", cfgFile, m.para.WorkDir)
+	return nil
+}
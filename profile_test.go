@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+// runWithOptions : Run the subcommand "sync" or "getmeasure" with options of the profile and retrieve the values of flags.
+func runWithOptions(t *testing.T, options map[string]string, args ...string) (map[string]string, error) {
+	m := initParams()
+	m.configFile.Options = options
+	got := map[string]string{}
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		&cli.StringFlag{Name: "ratelimit", EnvVars: []string{"GONETATMO_RATE_LIMIT"}},
+	}
+	app.Commands = []*cli.Command{
+		{
+			Name:  "sync",
+			Flags: []cli.Flag{&cli.StringFlag{Name: "format"}},
+			Action: func(c *cli.Context) error {
+				if err := m.applyOptions(c); err != nil {
+					return err
+				}
+				got["ratelimit"] = c.String("ratelimit")
+				got["format"] = c.String("format")
+				return nil
+			},
+		},
+		{
+			Name: "getmeasure",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "deviceid"},
+				&cli.IntFlag{Name: "limit"},
+			},
+			Action: func(c *cli.Context) error {
+				if err := m.applyOptions(c); err != nil {
+					return err
+				}
+				got["deviceid"] = c.String("deviceid")
+				return nil
+			},
+		},
+	}
+	err := app.Run(append([]string{appname}, args...))
+	return got, err
+}
+
+func TestApplyOptions(t *testing.T) {
+	options := map[string]string{"ratelimit": "20/10s,200/1h", "format": "csv"}
+	tests := []struct {
+		name      string
+		env       string
+		args      []string
+		ratelimit string
+		format    string
+	}{
+		{"options of profile", "", []string{"sync"}, "20/10s,200/1h", "csv"},
+		{"global flag has priority", "", []string{"--ratelimit", "off", "sync"}, "off", "csv"},
+		{"flag of subcommand has priority", "", []string{"sync", "--format", "json"}, "20/10s,200/1h", "json"},
+		{"environment variable has priority", "10/10s", []string{"sync"}, "10/10s", "csv"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				os.Setenv("GONETATMO_RATE_LIMIT", tt.env)
+				defer os.Unsetenv("GONETATMO_RATE_LIMIT")
+			}
+			got, err := runWithOptions(t, options, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got["ratelimit"] != tt.ratelimit || got["format"] != tt.format {
+				t.Errorf("ratelimit = %s, format = %s, want %s, %s", got["ratelimit"], got["format"], tt.ratelimit, tt.format)
+			}
+		})
+	}
+}
+
+func TestApplyOptionsOfOtherCommands(t *testing.T) {
+	options := map[string]string{"deviceid": "12:34:56:78:90:12", "unknown": "1"}
+	got, err := runWithOptions(t, options, "sync")
+	if err != nil {
+		t.Fatalf("option which the command doesn't define stops the command. %v", err)
+	}
+	if _, ok := got["deviceid"]; ok {
+		t.Error("getmeasure was run")
+	}
+	got, err = runWithOptions(t, options, "getmeasure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["deviceid"] != options["deviceid"] {
+		t.Errorf("deviceid = %s, want %s", got["deviceid"], options["deviceid"])
+	}
+	if _, err := runWithOptions(t, map[string]string{"limit": "abc"}, "getmeasure"); err == nil {
+		t.Error("wrong value of the option is not an error")
+	}
+}
+
+func TestSaveKeepsProfilesOfOtherProcesses(t *testing.T) {
+	dir := t.TempDir()
+	os.Unsetenv(storeEnv)
+	cfg := `{"profiles":{"lab":{"client_id":"lab","refresh_token":"lab-old"},"office":{"client_id":"office","refresh_token":"office-old"}}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, cfgFile), []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+	load := func(profile string) *materials {
+		m := initParams()
+		m.para.WorkDir = dir
+		m.profile = profile
+		if err := m.readcfgfile(); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	// "--profile office --key ###" loads the config file before the daemon refreshes the tokens of "lab".
+	office := load("office")
+	lab := load("lab")
+	lab.configFile.tokens = &tokens{Accesstoken: "lab-new", Refreshtoken: "lab-new"}
+	if err := lab.makecfgfile(); err != nil {
+		t.Fatal(err)
+	}
+	office.configFile.GoogleApiKey = "key"
+	if err := office.makecfgfile(); err != nil {
+		t.Fatal(err)
+	}
+	if err := office.saveProfiles(func(pf *profilesFile) { pf.DefaultProfile = "office" }); err != nil {
+		t.Fatal(err)
+	}
+	if m := load("lab"); m.configFile.Refreshtoken != "lab-new" {
+		t.Errorf("refresh token of lab = %s, want lab-new. It was overwritten by the old one.", m.configFile.Refreshtoken)
+	}
+	if m := load(""); m.profileName() != "office" || m.configFile.GoogleApiKey != "key" || m.configFile.Refreshtoken != "office-old" {
+		t.Errorf("office = %s, %s, %s", m.profileName(), m.configFile.GoogleApiKey, m.configFile.Refreshtoken)
+	}
+}
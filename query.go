@@ -0,0 +1,247 @@
+// Package main (query.go) :
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+	bolt "go.etcd.io/bbolt"
+)
+
+// querySummary : Statistics of values of a type of a module in a period.
+type querySummary struct {
+	Name        string             `json:"name"`
+	ModuleID    string             `json:"module_id"`
+	Type        string             `json:"type"`
+	Period      string             `json:"period"`
+	PeriodStart int64              `json:"period_start"`
+	Count       int                `json:"count"`
+	Min         float64            `json:"min"`
+	Max         float64            `json:"max"`
+	Avg         float64            `json:"avg"`
+	Percentiles map[string]float64 `json:"percentiles,omitempty"`
+}
+
+// values : Retrieve values of the type of module from begin to end.
+func (a *archive) values(am *archiveModule, t string, begin, end int64) ([]int64, []float64, error) {
+	var ts []int64
+	var vs []float64
+	err := a.db.View(func(tx *bolt.Tx) error {
+		mb := tx.Bucket(measuresBucket).Bucket(am.key())
+		if mb == nil {
+			return nil
+		}
+		tb := mb.Bucket([]byte(t))
+		if tb == nil {
+			return nil
+		}
+		cu := tb.Cursor()
+		for k, v := cu.Seek(encodeTime(begin)); k != nil && decodeTime(k) <= end; k, v = cu.Next() {
+			ts = append(ts, decodeTime(k))
+			vs = append(vs, decodeValue(v))
+		}
+		return nil
+	})
+	return ts, vs, err
+}
+
+// periodStart : Retrieve the start of the period including t. groupby is hour, day, week or none.
+func periodStart(t int64, groupby string) int64 {
+	d := time.Unix(t, 0).In(time.Local)
+	switch groupby {
+	case "hour":
+		return time.Date(d.Year(), d.Month(), d.Day(), d.Hour(), 0, 0, 0, time.Local).Unix()
+	case "day":
+		return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.Local).Unix()
+	case "week":
+		offset := (int(d.Weekday()) + 6) % 7 // Week starts on Monday.
+		return time.Date(d.Year(), d.Month(), d.Day()-offset, 0, 0, 0, 0, time.Local).Unix()
+	}
+	return 0
+}
+
+// percentile : Calculate the percentile p (0-100) of sorted values by the linear interpolation.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	r := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(r))
+	hi := int(math.Ceil(r))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(r-float64(lo))
+}
+
+// summarize : Calculate statistics of values grouped by the period.
+func summarize(am *archiveModule, t string, ts []int64, vs []float64, groupby string, ps []float64) []querySummary {
+	groups := map[int64][]float64{}
+	var starts []int64
+	for i, e := range ts {
+		s := periodStart(e, groupby)
+		if _, ok := groups[s]; !ok {
+			starts = append(starts, s)
+		}
+		groups[s] = append(groups[s], vs[i])
+	}
+	var res []querySummary
+	for _, s := range starts {
+		g := groups[s]
+		sort.Float64s(g)
+		var total float64
+		for _, v := range g {
+			total += v
+		}
+		qs := querySummary{
+			Name:        strings.TrimSpace(am.name() + " " + t),
+			ModuleID:    am.ModuleID,
+			Type:        t,
+			PeriodStart: s,
+			Count:       len(g),
+			Min:         g[0],
+			Max:         g[len(g)-1],
+			Avg:         math.Floor(total/float64(len(g))*100+.5) / 100,
+		}
+		if groupby == "none" || groupby == "" {
+			qs.PeriodStart = ts[0]
+		}
+		qs.Period = time.Unix(qs.PeriodStart, 0).In(time.Local).Format(time.RFC3339)
+		if len(ps) > 0 {
+			qs.Percentiles = map[string]float64{}
+			for _, p := range ps {
+				qs.Percentiles["p"+strconv.FormatFloat(p, 'f', -1, 64)] = percentile(g, p)
+			}
+		}
+		res = append(res, qs)
+	}
+	return res
+}
+
+// createOutputFormatForQuery : Create output format from results for query. Periods are formatted by layout.
+func createOutputFormatForQuery(res []querySummary, ps []float64, layout string) ([]string, [][]string) {
+	header := []string{"Name", "Period", "Count", "Min", "Max", "Avg"}
+	for _, p := range ps {
+		header = append(header, "P"+strconv.FormatFloat(p, 'f', -1, 64))
+	}
+	var data [][]string
+	for _, e := range res {
+		name := e.Name
+		if u, ok := valueUnits[strings.ToLower(e.Type)]; ok {
+			name += " [" + u + "]"
+		}
+		temp := []string{
+			name,
+			time.Unix(e.PeriodStart, 0).In(time.Local).Format(layout),
+			strconv.Itoa(e.Count),
+			strconv.FormatFloat(e.Min, 'f', -1, 64),
+			strconv.FormatFloat(e.Max, 'f', -1, 64),
+			strconv.FormatFloat(e.Avg, 'f', -1, 64),
+		}
+		for _, p := range ps {
+			temp = append(temp, strconv.FormatFloat(e.Percentiles["p"+strconv.FormatFloat(p, 'f', -1, 64)], 'f', 2, 64))
+		}
+		data = append(data, temp)
+	}
+	return header, data
+}
+
+// queryOptions : Retrieve the range and percentiles from inputted parameters.
+func queryOptions(c *cli.Context) (int64, int64, []float64, error) {
+	var begin int64
+	end := time.Now().Unix()
+	if c.String("datebegin") != "" {
+		t, err := time.Parse(time.RFC3339Nano, c.String("datebegin"))
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		begin = t.Unix()
+	}
+	if c.String("dateend") != "" {
+		t, err := time.Parse(time.RFC3339Nano, c.String("dateend"))
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		end = t.Unix()
+	}
+	switch c.String("groupby") {
+	case "hour", "day", "week", "none":
+	default:
+		return 0, 0, nil, errors.New("Please select groupby from hour, day, week and none.")
+	}
+	var ps []float64
+	for _, e := range strings.Split(c.String("percentiles"), ",") {
+		if strings.TrimSpace(e) == "" {
+			continue
+		}
+		p, err := strconv.ParseFloat(strings.TrimSpace(e), 64)
+		if err != nil || p < 0 || p > 100 {
+			return 0, 0, nil, errors.New(fmt.Sprintf("Wrong percentile '%s'. Please use values from 0 to 100.", e))
+		}
+		ps = append(ps, p)
+	}
+	return begin, end, ps, nil
+}
+
+// query : Display statistics of values in the local archive without accessing to Netatmo.
+func (m *materials) query(c *cli.Context) {
+	begin, end, ps, err := queryOptions(c)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	ar, err := openArchiveReadOnly(m.archivePath(c))
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	defer ar.Close()
+	ams, err := ar.modules()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	types := map[string]bool{}
+	for _, e := range strings.Split(c.String("type"), ",") {
+		if strings.TrimSpace(e) != "" {
+			types[strings.ToLower(strings.TrimSpace(e))] = true
+		}
+	}
+	var res []querySummary
+	for i := range ams {
+		am := &ams[i]
+		if mo := c.String("module"); mo != "" && !strings.EqualFold(mo, am.ModuleName) && !strings.EqualFold(mo, am.ModuleID) {
+			continue
+		}
+		for _, t := range am.Types {
+			if len(types) > 0 && !types[strings.ToLower(t)] {
+				continue
+			}
+			ts, vs, err := ar.values(am, t, begin, end)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			res = append(res, summarize(am, t, ts, vs, c.String("groupby"), ps)...)
+		}
+	}
+	switch outputFormat(c) {
+	case "json", "raw":
+		outjson, err := json.Marshal(res)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(outjson))
+	case "csv":
+		header, data := createOutputFormatForQuery(res, ps, time.RFC3339)
+		dispCSV(c, header, data)
+	default:
+		dispTable(createOutputFormatForQuery(res, ps, "20060102 15:04:05 MST"))
+	}
+}
@@ -0,0 +1,145 @@
+// Package main (scheduler.go) :
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule : Schedule of job.
+type schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// everySchedule : Schedule running every duration.
+type everySchedule struct {
+	every time.Duration
+}
+
+// Next : Retrieve the next time after t.
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Add(e.every)
+}
+
+// cronSchedule : Schedule of the cron format "minute hour day-of-month month day-of-week".
+type cronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+	domAll, dowAll                bool
+}
+
+// Next : Retrieve the next time after t. Times are evaluated in the local time zone.
+func (cs *cronSchedule) Next(t time.Time) time.Time {
+	n := t.In(time.Local).Truncate(time.Minute).Add(time.Minute)
+	for i := 0; i < 366*24*60*5; i++ {
+		if cs.month[int(n.Month())] && cs.hour[n.Hour()] && cs.minute[n.Minute()] && cs.matchDay(n) {
+			return n
+		}
+		n = n.Add(time.Minute)
+	}
+	return time.Time{}
+}
+
+// matchDay : When both day-of-month and day-of-week are restricted, either of them is required to match as cron.
+func (cs *cronSchedule) matchDay(t time.Time) bool {
+	dom := cs.dom[t.Day()]
+	dow := cs.dow[int(t.Weekday())]
+	switch {
+	case cs.domAll && cs.dowAll:
+		return true
+	case cs.domAll:
+		return dow
+	case cs.dowAll:
+		return dom
+	}
+	return dom || dow
+}
+
+// parseCronField : Parse a field of cron. "*", "*/n", "a-b", "a-b/n" and lists separated by "," can be used.
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	res := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return nil, errors.New(fmt.Sprintf("Wrong step '%s'.", part))
+			}
+			step = s
+			part = part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			if i := strings.Index(part, "-"); i >= 0 {
+				var err1, err2 error
+				lo, err1 = strconv.Atoi(part[:i])
+				hi, err2 = strconv.Atoi(part[i+1:])
+				if err1 != nil || err2 != nil {
+					return nil, errors.New(fmt.Sprintf("Wrong range '%s'.", part))
+				}
+			} else {
+				v, err := strconv.Atoi(part)
+				if err != nil {
+					return nil, errors.New(fmt.Sprintf("Wrong value '%s'.", part))
+				}
+				lo, hi = v, v
+				if step > 1 {
+					hi = max
+				}
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, errors.New(fmt.Sprintf("'%s' is out of range from %d to %d.", part, min, max))
+		}
+		for v := lo; v <= hi; v += step {
+			res[v] = true
+		}
+	}
+	return res, nil
+}
+
+// parseSchedule : Parse schedule. "@every 10m", "10m", "@hourly", "@daily", "@weekly" and the cron format like "*/10 * * * *" can be used.
+func parseSchedule(spec string) (schedule, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	}
+	if d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every"))); err == nil {
+		if d < time.Minute {
+			return nil, errors.New(fmt.Sprintf("Error: Schedule '%s' is too short. Please use 1m or more.", spec))
+		}
+		return everySchedule{every: d}, nil
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.New(fmt.Sprintf("Error: Wrong schedule '%s'. Please use '@every 10m' or the cron format like '*/10 * * * *'.", spec))
+	}
+	cs := &cronSchedule{domAll: fields[2] == "*", dowAll: fields[4] == "*"}
+	var err error
+	ranges := []struct {
+		dst      *map[int]bool
+		min, max int
+	}{
+		{&cs.minute, 0, 59},
+		{&cs.hour, 0, 23},
+		{&cs.dom, 1, 31},
+		{&cs.month, 1, 12},
+		{&cs.dow, 0, 7},
+	}
+	for i, r := range ranges {
+		if *r.dst, err = parseCronField(fields[i], r.min, r.max); err != nil {
+			return nil, errors.New(fmt.Sprintf("Error: Wrong schedule '%s'. %v", spec, err))
+		}
+	}
+	if cs.dow[7] {
+		cs.dow[0] = true // 7 is also Sunday.
+	}
+	return cs, nil
+}
@@ -0,0 +1,308 @@
+// Package main (secretstore.go) :
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/urfave/cli"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+const (
+	storeEnv       = "GONETATMO_SECRET_STORE" // Secret store for a new config file. file, encrypted or keyring.
+	passphraseEnv  = "GONETATMO_PASSPHRASE"
+	keyringService = appname
+	encryptedMagic = "gonetatmo-secretbox-v1\n"
+)
+
+// secretStore : Store of the config file including client secret and tokens.
+type secretStore interface {
+	Name() string
+	Load() ([]byte, error) // The error is os.ErrNotExist when the config doesn't exist.
+	Save(b []byte) error
+	Delete() error
+}
+
+// keyringStub : Content of the config file when the config is stored in the keyring.
+type keyringStub struct {
+	SecretStore string `json:"secret_store"`
+	KeyringUser string `json:"keyring_user"`
+}
+
+// fileStore : Config file of plain JSON. Only the owner can read it.
+type fileStore struct {
+	path string
+}
+
+// Name : Name of store.
+func (fs *fileStore) Name() string { return "file" }
+
+// Load : Read config.
+func (fs *fileStore) Load() ([]byte, error) {
+	return ioutil.ReadFile(fs.path)
+}
+
+// Save : Write config with the permission of 0600.
+func (fs *fileStore) Save(b []byte) error {
+	return writeSecretFile(fs.path, b)
+}
+
+// Delete : Remove config file.
+func (fs *fileStore) Delete() error {
+	return os.Remove(fs.path)
+}
+
+// writeSecretFile : Write file with the permission of 0600 atomically. The content is written to a temporary file
+// in the same directory and it is renamed to path, so other processes never read the file which is being written.
+func writeSecretFile(path string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := f.Chmod(0600); err != nil && runtime.GOOS != "windows" {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// encryptedStore : Config file encrypted by NaCl secretbox with the key derived from the passphrase by scrypt.
+type encryptedStore struct {
+	path       string
+	passphrase func() (string, error)
+}
+
+// Name : Name of store.
+func (es *encryptedStore) Name() string { return "encrypted" }
+
+// key : Derive key from passphrase and salt.
+func (es *encryptedStore) key(salt []byte) (*[32]byte, error) {
+	p, err := es.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	k, err := scrypt.Key([]byte(p), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	var key [32]byte
+	copy(key[:], k)
+	return &key, nil
+}
+
+// Load : Read and decrypt config. The content is "magic + base64(salt + nonce + box)".
+func (es *encryptedStore) Load() ([]byte, error) {
+	b, err := ioutil.ReadFile(es.path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(bytes.TrimPrefix(b, []byte(encryptedMagic)))))
+	if err != nil || len(raw) < 16+24+secretbox.Overhead {
+		return nil, errors.New(fmt.Sprintf("Error: '%s' is broken.", es.path))
+	}
+	key, err := es.key(raw[:16])
+	if err != nil {
+		return nil, err
+	}
+	var nonce [24]byte
+	copy(nonce[:], raw[16:40])
+	out, ok := secretbox.Open(nil, raw[40:], &nonce, key)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Error: Couldn't decrypt '%s'. The passphrase may be wrong.", es.path))
+	}
+	return out, nil
+}
+
+// Save : Encrypt and write config.
+func (es *encryptedStore) Save(b []byte) error {
+	raw := make([]byte, 40)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	key, err := es.key(raw[:16])
+	if err != nil {
+		return err
+	}
+	var nonce [24]byte
+	copy(nonce[:], raw[16:40])
+	raw = secretbox.Seal(raw, b, &nonce, key)
+	return writeSecretFile(es.path, []byte(encryptedMagic+base64.StdEncoding.EncodeToString(raw)+"\n"))
+}
+
+// Delete : Remove config file.
+func (es *encryptedStore) Delete() error {
+	return os.Remove(es.path)
+}
+
+// keyringStore : Config stored in the OS keyring (Secret Service, Keychain and Credential Manager).
+// The config file has only keyringStub.
+type keyringStore struct {
+	path string
+	user string
+}
+
+// Name : Name of store.
+func (ks *keyringStore) Name() string { return "keyring" }
+
+// Load : Read config from keyring.
+func (ks *keyringStore) Load() ([]byte, error) {
+	s, err := keyring.Get(keyringService, ks.user)
+	if err == keyring.ErrNotFound {
+		return nil, os.ErrNotExist
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error: Couldn't read the keyring. %v", err))
+	}
+	return []byte(s), nil
+}
+
+// Save : Write config to keyring and the stub to the config file.
+func (ks *keyringStore) Save(b []byte) error {
+	if err := keyring.Set(keyringService, ks.user, string(b)); err != nil {
+		return errors.New(fmt.Sprintf("Error: Couldn't write the keyring. %v", err))
+	}
+	stub, _ := json.MarshalIndent(keyringStub{SecretStore: "keyring", KeyringUser: ks.user}, "", "\t")
+	return writeSecretFile(ks.path, stub)
+}
+
+// Delete : Remove config from keyring and the stub.
+func (ks *keyringStore) Delete() error {
+	if err := keyring.Delete(keyringService, ks.user); err != nil && err != keyring.ErrNotFound {
+		return err
+	}
+	return os.Remove(ks.path)
+}
+
+// readPassphrase : Retrieve passphrase from the environment variable or the prompt without echo.
+func readPassphrase(prompt string) (string, error) {
+	if p := os.Getenv(passphraseEnv); p != "" {
+		return p, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", errors.New(fmt.Sprintf("Error: Passphrase is required. Please set it to the environment variable '%s'.", passphraseEnv))
+	}
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	p, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if len(p) == 0 {
+		return "", errors.New("Error: Passphrase is empty.")
+	}
+	return string(p), nil
+}
+
+// cachedPassphrase : Ask passphrase only once.
+func cachedPassphrase(prompt string) func() (string, error) {
+	var p string
+	return func() (string, error) {
+		if p != "" {
+			return p, nil
+		}
+		var err error
+		p, err = readPassphrase(prompt)
+		return p, err
+	}
+}
+
+// newStore : Create store by name.
+func newStore(name, path string) (secretStore, error) {
+	switch name {
+	case "", "file":
+		return &fileStore{path: path}, nil
+	case "encrypted":
+		return &encryptedStore{path: path, passphrase: cachedPassphrase("Passphrase for " + cfgFile)}, nil
+	case "keyring":
+		return &keyringStore{path: path, user: path}, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Error: Wrong secret store '%s'. Please select from file, encrypted and keyring.", name))
+}
+
+// detectStore : Detect the store from the config file. When the config file doesn't exist, the store of the environment variable is used.
+func detectStore(path string) (secretStore, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return newStore(os.Getenv(storeEnv), path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(b, []byte(encryptedMagic)) {
+		return newStore("encrypted", path)
+	}
+	stub := keyringStub{}
+	if json.Unmarshal(b, &stub) == nil && stub.SecretStore == "keyring" {
+		return &keyringStore{path: path, user: stub.KeyringUser}, nil
+	}
+	return &fileStore{path: path}, nil
+}
+
+// migrate : Move the config file to the selected store. The lock is held, so the tokens refreshed by other processes are not lost.
+func (m *materials) migrate(c *cli.Context) {
+	unlock, err := m.lockCfg()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	defer unlock()
+	from, err := m.secretStore()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	b, err := from.Load()
+	if os.IsNotExist(err) {
+		fmt.Printf("Error: No config file at %s.\n", m.para.WorkDir)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	to, err := newStore(c.String("to"), m.cfgPath())
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if es, ok := to.(*encryptedStore); ok {
+		es.passphrase = cachedPassphrase("New passphrase for " + cfgFile)
+	} else if to.Name() == from.Name() {
+		fmt.Printf("'%s' is already stored in %s.\n", cfgFile, to.Name())
+		return
+	}
+	if err := to.Save(b); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if ks, ok := from.(*keyringStore); ok && to.Name() != "keyring" {
+		if err := keyring.Delete(keyringService, ks.user); err != nil && err != keyring.ErrNotFound {
+			fmt.Fprintf(os.Stderr, "Error: Couldn't remove the config from the keyring. %v\n", err)
+		}
+	}
+	fmt.Printf("Moved '%s' from %s to %s.\n", cfgFile, from.Name(), to.Name())
+}
@@ -0,0 +1,140 @@
+// Package main (token.go) :
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tanaikech/gonetatmo/netatmo"
+	"github.com/urfave/cli"
+)
+
+// tokenStatus : Status of the authorization of the profile.
+type tokenStatus struct {
+	Profile     string   `json:"profile"`
+	ConfigFile  string   `json:"config_file"`
+	SecretStore string   `json:"secret_store"`
+	ClientId    string   `json:"client_id"`
+	Scopes      []string `json:"scopes"`
+	EndTimeDate string   `json:"end_time_date"`
+	Remaining   string   `json:"remaining"`
+	Valid       bool     `json:"valid"`
+	Message     string   `json:"message,omitempty"`
+}
+
+// loadProfileForAuth : Read the selected profile for auth status, refresh and logout.
+func (m *materials) loadProfileForAuth() {
+	if err := m.readcfgfile(); err != nil {
+		if os.IsNotExist(err) {
+			fmt.Printf("Error: No config file at %s. Please authorize gonetatmo.\n\n $ gonetatmo auth login --clientid ### --clientsecret ###\n\n", m.para.WorkDir)
+		} else {
+			fmt.Printf("%v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// remaining : Retrieve the remaining lifetime of the access token.
+func (m *materials) remaining() time.Duration {
+	if m.configFile.tokens.EndTime == 0 {
+		return 0
+	}
+	return time.Until(time.Unix(m.configFile.tokens.EndTime, 0)).Round(time.Second)
+}
+
+// authStatus : Display the status of the authorization. The access token is validated by getstationsdata.
+// The access token is not refreshed, so the rejected access token is reported as it is.
+func (m *materials) authStatus(c *cli.Context) {
+	m.loadProfileForAuth()
+	st := &tokenStatus{
+		Profile:     m.profileName(),
+		ConfigFile:  m.cfgPath(),
+		SecretStore: m.store.Name(),
+		ClientId:    m.configFile.ClientId,
+		Scopes:      m.configFile.tokens.Scope,
+		EndTimeDate: m.configFile.tokens.EndTimeDate,
+	}
+	if len(st.Scopes) == 0 {
+		st.Scopes = m.configFile.Scopes
+	}
+	switch d := m.remaining(); {
+	case m.configFile.tokens.Accesstoken == "":
+		st.Remaining = "no token"
+		st.Message = "No access token. Please run 'gonetatmo auth login'."
+	case d <= 0:
+		st.Remaining = "expired"
+		st.Message = "The access token has expired. It is refreshed at the next command or 'gonetatmo auth refresh'."
+	default:
+		st.Remaining = d.String()
+		if _, err := netatmo.NewClient(netatmo.StaticToken(m.configFile.tokens.Accesstoken)).StationsDataRaw(nil); err != nil {
+			st.Message = strings.TrimSpace(fmt.Sprintf("Validation failed. %v", err))
+		} else {
+			st.Valid = true
+		}
+	}
+	if outputFormat(c) == "json" {
+		b, _ := json.Marshal(st)
+		fmt.Println(string(b))
+	} else {
+		dispTable([]string{"Item", "Value"}, [][]string{
+			{"Profile", st.Profile},
+			{"Config file", st.ConfigFile},
+			{"Secret store", st.SecretStore},
+			{"Client ID", st.ClientId},
+			{"Scopes", strings.Join(st.Scopes, ",")},
+			{"Expiration", st.EndTimeDate},
+			{"Remaining", st.Remaining},
+			{"Valid", fmt.Sprintf("%v", st.Valid)},
+		})
+		if st.Message != "" {
+			fmt.Println(st.Message)
+		}
+	}
+	if !st.Valid {
+		os.Exit(1)
+	}
+}
+
+// authRefresh : Retrieve new access token by the refresh token even if the access token doesn't expire.
+func (m *materials) authRefresh(c *cli.Context) {
+	m.loadProfileForAuth()
+	if m.configFile.tokens.Refreshtoken == "" {
+		fmt.Printf("Error: No refresh token. Please authorize gonetatmo.\n\n $ gonetatmo auth login\n\n")
+		os.Exit(1)
+	}
+	if err := m.resolveCredentials(c); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if err := m.refreshTokens(0, true); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Access token was refreshed. It expires at %s.\n", m.configFile.tokens.EndTimeDate)
+}
+
+// logout : Remove the tokens of the profile from the config file. Client id, client secret and options are kept.
+// The config file is read again holding the lock, so the tokens refreshed by another process are also removed.
+func (m *materials) logout(c *cli.Context) {
+	m.loadProfileForAuth()
+	unlock, err := m.lockCfg()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	defer unlock()
+	m.loadProfileForAuth()
+	if m.configFile.tokens.Accesstoken == "" && m.configFile.tokens.Refreshtoken == "" {
+		fmt.Printf("Profile '%s' has no tokens.\n", m.profileName())
+		return
+	}
+	m.configFile.tokens = &tokens{}
+	if err := m.writecfgfile(); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Tokens of profile '%s' were removed.\n", m.profileName())
+}
@@ -0,0 +1,223 @@
+// Package main (webhook.go) :
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/tanaikech/gonetatmo/netatmo"
+	"github.com/urfave/cli"
+)
+
+const (
+	signatureHeader = "X-Gonetatmo-Signature"
+)
+
+// webhookTemplates : Built-in templates for incoming webhooks.
+var webhookTemplates = map[string]string{
+	"json":    `{{json .}}`,
+	"slack":   `{"text": {{json .Text}}}`,
+	"discord": `{"content": {{json .Text}}}`,
+	"teams":   `{"text": {{json .Text}}}`,
+}
+
+// webhookData : Data given to the template of webhook.
+type webhookData struct {
+	Time     int64                    `json:"time"`
+	Text     string                   `json:"text"` // Summary for chat services.
+	Stations []stationsdataForOutput  `json:"stations,omitempty"`
+	Averages []map[string]interface{} `json:"averages,omitempty"`
+	Event    *alertEvent              `json:"event,omitempty"`
+}
+
+// webhookFuncs : Functions for the template of webhook.
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"date": func(t int64) string {
+		return time.Unix(t, 0).In(time.Local).Format(time.RFC3339)
+	},
+}
+
+// parseWebhookTemplate : Parse template. name is a built-in template or a text/template.
+func parseWebhookTemplate(name string) (*template.Template, error) {
+	if name == "" {
+		name = "json"
+	}
+	if t, ok := webhookTemplates[name]; ok {
+		name = t
+	}
+	t, err := template.New("webhook").Funcs(webhookFuncs).Parse(name)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error: Wrong template. %v", err))
+	}
+	return t, nil
+}
+
+// stationsText : Create a summary of stations for chat services.
+func stationsText(sts []stationsdataForOutput) string {
+	var lines []string
+	for _, st := range sts {
+		stationName := ""
+		for _, f := range st.Inside {
+			stationName = f.StationName
+			lines = append(lines, fmt.Sprintf("%s %s: %v°C %v%% CO2 %dppm %vhPa", f.StationName, f.ModuleName, f.Temperature, f.Humidity, f.CO2, f.Pressure))
+		}
+		for _, f := range append(append([]outsideData{}, st.IndoorModule...), st.Outside...) {
+			name := strings.TrimSpace(stationName + " " + f.ModuleName)
+			switch f.Type {
+			case netatmo.TypeWind:
+				lines = append(lines, fmt.Sprintf("%s: wind %dkm/h gust %dkm/h", name, f.WindStrength, f.GustStrength))
+			case netatmo.TypeRain:
+				lines = append(lines, fmt.Sprintf("%s: rain %vmm (1h %vmm, 24h %vmm)", name, f.Rain, f.SumRain1, f.SumRain24))
+			default:
+				lines = append(lines, fmt.Sprintf("%s: %v°C %v%%", name, f.Temperature, f.Humidity))
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// averagesText : Create a summary of averages of public data for chat services.
+func averagesText(averages []map[string]interface{}) string {
+	var lines []string
+	for _, a := range averages {
+		for k, v := range a {
+			if strings.HasSuffix(k, "_c") || v == nil {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%s: %v (%v stations)", k, v, a[k+"_c"]))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// webhook : Sender of POST requests with the templated payload.
+type webhook struct {
+	URL      string
+	Headers  map[string]string
+	Template *template.Template
+	Secret   string // The payload is signed by HMAC-SHA256 with this.
+	Retry    int
+	Client   *http.Client
+}
+
+// sign : Retrieve the signature of body as "sha256=<hex>".
+func sign(secret string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(body)
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}
+
+// send : Execute template with data and post it. Network errors, 429 and 5xx are retried with the exponential backoff.
+func (w *webhook) send(data *webhookData) error {
+	b := &bytes.Buffer{}
+	if err := w.Template.Execute(b, data); err != nil {
+		return errors.New(fmt.Sprintf("Error: Couldn't execute template. %v", err))
+	}
+	body := b.Bytes()
+	headers := map[string]string{"Content-Type": "application/json"}
+	for k, v := range w.Headers {
+		headers[k] = v
+	}
+	if w.Secret != "" {
+		headers[signatureHeader] = sign(w.Secret, body)
+	}
+	return postWithRetry(w.Client, w.URL, headers, body, w.Retry, "Webhook")
+}
+
+// Notify : Send event of alert.
+func (w *webhook) Notify(e alertEvent) error {
+	return w.send(&webhookData{Time: e.Time, Text: e.Message, Event: &e})
+}
+
+// parseHeaders : Parse headers of "Key: Value".
+func parseHeaders(hs []string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, h := range hs {
+		i := strings.Index(h, ":")
+		if i <= 0 {
+			return nil, errors.New(fmt.Sprintf("Error: Wrong header '%s'. Please use 'Key: Value'.", h))
+		}
+		res[strings.TrimSpace(h[:i])] = strings.TrimSpace(h[i+1:])
+	}
+	return res, nil
+}
+
+// report : Retrieve station data and averages of public data, and send them.
+func (m *materials) report(c *cli.Context, w *webhook) error {
+	sd, err := m.client.StationsData(nil)
+	if err != nil {
+		return err
+	}
+	data := &webhookData{Time: time.Now().Unix(), Stations: newStations(sd).Stations}
+	data.Text = stationsText(data.Stations)
+	if c.Float64("latitude") != 0 || c.Float64("longitude") != 0 {
+		if data.Averages, err = m.publicAverages(c.Float64("latitude"), c.Float64("longitude"), c.Float64("range"), c.String("type")); err != nil {
+			return err
+		}
+		data.Text += "\n" + averagesText(data.Averages)
+	}
+	return w.send(data)
+}
+
+// notifyWebhook : Send station data to webhook with the templated payload once or every interval.
+func (m *materials) notifyWebhook(c *cli.Context) {
+	tmpl := c.String("template")
+	if c.String("templatefile") != "" {
+		b, err := ioutil.ReadFile(c.String("templatefile"))
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		tmpl = string(b)
+	}
+	t, err := parseWebhookTemplate(tmpl)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	headers, err := parseHeaders(c.StringSlice("header"))
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	w := &webhook{URL: c.String("url"), Headers: headers, Template: t, Secret: c.String("secret"), Retry: c.Int("retry")}
+	if w.URL == "" {
+		fmt.Printf("Error: Please input the URL of webhook.\n\n $ gonetatmo webhook --url https://###\n\n")
+		os.Exit(1)
+	}
+	if c.String("interval") == "" {
+		if err := m.report(c, w); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	interval, err := time.ParseDuration(c.String("interval"))
+	if err != nil || interval < time.Minute {
+		fmt.Printf("Error: Please input the interval of 1m or more. e.g. '10m'\n")
+		os.Exit(1)
+	}
+	for {
+		if err := m.refreshIfExpiring(5 * time.Minute); err != nil {
+			logf("Error: %v", err)
+		} else if err := m.report(c, w); err != nil {
+			logf("%v", err)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	var body []byte
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		header = r.Header
+	}))
+	defer srv.Close()
+	tmpl, err := parseWebhookTemplate("json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &webhook{URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer token"}, Template: tmpl, Secret: "secret", Client: srv.Client()}
+	if err := w.send(&webhookData{Time: 1600000000, Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); header.Get(signatureHeader) != want {
+		t.Errorf("%s = %s, want %s", signatureHeader, header.Get(signatureHeader), want)
+	}
+	if header.Get("Authorization") != "Bearer token" || header.Get("Content-Type") != "application/json" {
+		t.Errorf("headers are %v", header)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	defer func(d time.Duration) { retryWait = d }(retryWait)
+	retryWait = time.Millisecond
+	tests := []struct {
+		name     string
+		statuses []int
+		calls    int
+		ok       bool
+	}{
+		{"success", []int{200}, 1, true},
+		{"retry 429", []int{429, 200}, 2, true},
+		{"retry 5xx", []int{500, 503, 204}, 3, true},
+		{"give up after retries", []int{502, 502, 502, 502}, 3, false},
+		{"no retry for 4xx", []int{400, 200}, 1, false},
+		{"no retry for 404", []int{404, 200}, 1, false},
+	}
+	tmpl, _ := parseWebhookTemplate("slack")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statuses[calls])
+				calls++
+			}))
+			defer srv.Close()
+			w := &webhook{URL: srv.URL, Template: tmpl, Retry: 2, Client: srv.Client()}
+			err := w.send(&webhookData{Text: "hello"})
+			if (err == nil) != tt.ok {
+				t.Errorf("error is %v", err)
+			}
+			if calls != tt.calls {
+				t.Errorf("requests = %d, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestWebhookTemplates(t *testing.T) {
+	data := &webhookData{Time: 1600000000, Text: "Home \"Living\": 21.5°C\nOutdoor: 10°C"}
+	tests := map[string]string{
+		"json":    "text",
+		"slack":   "text",
+		"discord": "content",
+		"teams":   "text",
+	}
+	for name, key := range tests {
+		tmpl, err := parseWebhookTemplate(name)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		b := &bytes.Buffer{}
+		if err := tmpl.Execute(b, data); err != nil {
+			t.Fatal(name, err)
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+			t.Fatalf("%s is not JSON. %v: %s", name, err, b.String())
+		}
+		if got[key] != data.Text {
+			t.Errorf("%s: %s = %v, want %s", name, key, got[key], data.Text)
+		}
+	}
+	if _, err := parseWebhookTemplate("{{.Text"); err == nil || !strings.Contains(err.Error(), "Wrong template") {
+		t.Errorf("wrong template is not an error. %v", err)
+	}
+}